@@ -5,7 +5,6 @@ import (
 	"github.com/OddOneOutApp/backend/internal/database"
 	"github.com/OddOneOutApp/backend/internal/http"
 	"github.com/OddOneOutApp/backend/internal/services"
-	"github.com/OddOneOutApp/backend/internal/services/cleanup"
 	"github.com/OddOneOutApp/backend/internal/utils"
 	"github.com/OddOneOutApp/backend/internal/websocket"
 )
@@ -18,9 +17,9 @@ func main() {
 	db := database.New()
 
 	services.InitializeQuestionService()
-	websocket.Init()
+	websocket.Init(cfg)
 
-	cleanup.StartEndScheduler(db)
+	websocket.RestorePhaseTimers(db)
 
 	http.Initialize(db, cfg)
 }
@@ -2,15 +2,31 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/OddOneOutApp/backend/internal/utils"
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Host   string `env:"HOST" envDefault:"localhost"`
-	Secure bool
+	Host            string `env:"HOST" envDefault:"localhost"`
+	Secure          bool
+	HostGracePeriod time.Duration `env:"HOST_GRACE_PERIOD" envDefault:"30s"`
+	// How long a disconnected player is waited for before they count as gone
+	PresenceGracePeriod time.Duration `env:"PRESENCE_GRACE_PERIOD" envDefault:"60s"`
+	// Websocket heartbeat: pings are sent every PingInterval and a peer that
+	// does not answer within PongWait is disconnected
+	PingInterval   time.Duration `env:"WS_PING_INTERVAL" envDefault:"30s"`
+	PongWait       time.Duration `env:"WS_PONG_WAIT" envDefault:"60s"`
+	WriteWait      time.Duration `env:"WS_WRITE_WAIT" envDefault:"10s"`
+	MaxMessageSize int64         `env:"WS_MAX_MESSAGE_SIZE" envDefault:"4096"`
+	// How often the batched audience vote tallies are sent
+	AudienceTallyInterval time.Duration `env:"AUDIENCE_TALLY_INTERVAL" envDefault:"2s"`
+	// Reverse proxies whose X-Forwarded-For header is trusted, comma separated.
+	// Without any, the client address is the one of the TCP connection.
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
 }
 
 func Load() *Config {
@@ -20,8 +36,16 @@ func Load() *Config {
 	}
 
 	cfg := &Config{
-		Host:   os.Getenv("HOST"),
-		Secure: strings.ToLower(os.Getenv("SECURE")) == "true",
+		Host:                  os.Getenv("HOST"),
+		Secure:                strings.ToLower(os.Getenv("SECURE")) == "true",
+		HostGracePeriod:       durationFromEnv("HOST_GRACE_PERIOD", 30*time.Second),
+		PresenceGracePeriod:   durationFromEnv("PRESENCE_GRACE_PERIOD", 60*time.Second),
+		PingInterval:          durationFromEnv("WS_PING_INTERVAL", 30*time.Second),
+		PongWait:              durationFromEnv("WS_PONG_WAIT", 60*time.Second),
+		WriteWait:             durationFromEnv("WS_WRITE_WAIT", 10*time.Second),
+		MaxMessageSize:        int64FromEnv("WS_MAX_MESSAGE_SIZE", 4096),
+		AudienceTallyInterval: durationFromEnv("AUDIENCE_TALLY_INTERVAL", 2*time.Second),
+		TrustedProxies:        listFromEnv("TRUSTED_PROXIES"),
 	}
 
 	validate(cfg)
@@ -33,4 +57,53 @@ func validate(cfg *Config) {
 	if cfg.Host == "" {
 		utils.Logger.Fatal("Host (e.g. example.com) must be set in environment variables")
 	}
+	if cfg.PingInterval <= 0 {
+		utils.Logger.Fatal("WS_PING_INTERVAL must be positive")
+	}
+	if cfg.PingInterval >= cfg.PongWait {
+		utils.Logger.Fatal("WS_PING_INTERVAL must be shorter than WS_PONG_WAIT")
+	}
+	if cfg.MaxMessageSize <= 0 {
+		utils.Logger.Fatal("WS_MAX_MESSAGE_SIZE must be positive")
+	}
+	if cfg.AudienceTallyInterval <= 0 {
+		utils.Logger.Fatal("AUDIENCE_TALLY_INTERVAL must be positive")
+	}
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		utils.Logger.Fatalf("%s must be a duration (e.g. 30s): %v", key, err)
+	}
+	return duration
+}
+
+func int64FromEnv(key string, fallback int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		utils.Logger.Fatalf("%s must be a number: %v", key, err)
+	}
+	return number
+}
+
+func listFromEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
 }
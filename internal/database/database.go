@@ -14,9 +14,14 @@ func New() *gorm.DB {
 	}
 
 	// Auto-migrate the models
-	err = db.AutoMigrate(&services.Game{}, &services.GameMember{}, &services.Session{}, &services.Answer{})
+	err = db.AutoMigrate(&services.Game{}, &services.GameSettings{}, &services.GameMember{}, &services.Session{}, &services.Round{}, &services.Answer{}, &services.Vote{}, &services.Ban{}, &services.AudienceVote{}, &services.ChatMessage{})
 	if err != nil {
 		utils.Logger.Fatalf("failed to auto-migrate database: %v", err)
 	}
+
+	err = services.MigrateLegacySettings(db)
+	if err != nil {
+		utils.Logger.Fatalf("failed to migrate game settings: %v", err)
+	}
 	return db
 }
@@ -2,7 +2,10 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	"net/http"
 	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/OddOneOutApp/backend/internal/config"
@@ -11,19 +14,30 @@ import (
 	"github.com/OddOneOutApp/backend/internal/websocket"
 	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 func Initialize(db *gorm.DB, cfg *config.Config) {
 	router := gin.Default()
+	// Client addresses, e.g. in the request logs, must not be spoofable with
+	// a forwarded header
+	err := router.SetTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		utils.Logger.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	router.Use(ginzap.Ginzap(utils.RawLogger, time.RFC3339, true))
 
+	audienceRegex := regexp.MustCompile(`^/api/games/[a-zA-Z0-9]+/audience$`)
+
 	router.Use(func(c *gin.Context) {
 		regex := regexp.MustCompile(`^/api/games(/[a-zA-Z0-9]+/join)?$`)
 		path := c.Request.URL.Path
 
-		if path == "/api/categories" {
+		// viewers watch games without a session
+		if path == "/api/categories" || path == "/api/scoring-modes" || audienceRegex.MatchString(path) {
 			c.Next()
 			return
 		}
@@ -41,6 +55,8 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 			requestBody := struct {
 				Username string `json:"username"`
 				Category string `json:"category,omitempty"`
+				Rounds   int    `json:"rounds,omitempty"`
+				Scoring  string `json:"scoring,omitempty"`
 			}{}
 			err = json.NewDecoder(c.Request.Body).Decode(&requestBody)
 			if err != nil {
@@ -66,6 +82,8 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 			c.Set("session", session)
 			c.Set("username", session.Username)
 			c.Set("category", requestBody.Category)
+			c.Set("rounds", requestBody.Rounds)
+			c.Set("scoring", requestBody.Scoring)
 			c.Next()
 			return
 		}
@@ -119,12 +137,16 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 		type createGameRequest struct {
 			Category string `json:"category"`
 			Username string `json:"username"`
+			Rounds   int    `json:"rounds"`
+			Scoring  string `json:"scoring"`
 		}
 
 		var requestBody createGameRequest
 		if err := c.ShouldBindJSON(&requestBody); err != nil {
 			requestBody.Username = session.Username
 			requestBody.Category = c.GetString("category")
+			requestBody.Rounds = c.GetInt("rounds")
+			requestBody.Scoring = c.GetString("scoring")
 		}
 
 		// Make sure category is not empty
@@ -135,7 +157,14 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 			return
 		}
 
-		game, err := services.CreateGame(db, cfg, session.ID, requestBody.Category)
+		if requestBody.Rounds == 0 {
+			requestBody.Rounds = services.DefaultRoundCount
+		}
+		if requestBody.Scoring == "" {
+			requestBody.Scoring = services.DefaultScoringMode
+		}
+
+		game, err := services.CreateGame(db, cfg, session.ID, requestBody.Category, requestBody.Rounds, requestBody.Scoring)
 		if err != nil {
 			if err.Error() == "user is already in a game" {
 				c.JSON(400, gin.H{
@@ -143,12 +172,21 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 				})
 				return
 			}
+			var settingsErr *services.SettingsError
+			if errors.As(err, &settingsErr) {
+				c.JSON(400, gin.H{
+					"error": "Invalid game settings: " + settingsErr.Error(),
+				})
+				return
+			}
 			c.JSON(500, gin.H{
 				"error": "Internal server error",
 			})
 			utils.Logger.Errorf("Error creating game: %v", err)
 			return
 		}
+		websocket.HubInstance.MemberJoined(game.ID, session.ID)
+		websocket.PresenceInstance.Joined(db, game.ID, session.ID)
 		utils.Logger.Infof("Game created with ID: %s for session ID: %s", game.ID, session.ID)
 		c.JSON(200, gin.H{
 			"message": "Game created successfully",
@@ -180,7 +218,7 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 			return
 		}
 
-		_, err = game.Join(db, session.ID)
+		member, err := game.Join(db, session.ID)
 		if err != nil {
 			if err == gorm.ErrRecordNotFound {
 				c.JSON(404, gin.H{
@@ -194,17 +232,32 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 				})
 				return
 			}
+			if err == services.ErrBanned {
+				c.JSON(403, gin.H{
+					"error": "You are banned from this game",
+				})
+				return
+			}
+			if err == services.ErrGameLocked {
+				c.JSON(403, gin.H{
+					"error": "Game is locked",
+				})
+				return
+			}
 			utils.Logger.Errorf("Error joining game: %v", err)
 			c.JSON(500, gin.H{
 				"error": "Internal server error",
 			})
 			return
 		}
+		websocket.HubInstance.MemberJoined(gameID, session.ID)
+		websocket.PresenceInstance.Joined(db, gameID, session.ID)
 		utils.Logger.Infof("User with session ID: %s joined game with ID: %s", session.SessionID, gameID)
 		c.JSON(200, gin.H{
 			"message": "Joined game successfully",
 			"data": gin.H{
 				"game_id": gameID,
+				"role":    member.Role,
 			},
 		})
 	})
@@ -249,7 +302,21 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 			})
 			return
 		}
+		// Hand the lobby over to another member, only delete it if the host was alone
+		deleteGame := false
 		if isHost {
+			_, err = websocket.MigrateHost(db, gameID)
+			if err == services.ErrNoMembersLeft {
+				deleteGame = true
+			} else if err != nil {
+				utils.Logger.Errorf("Error migrating host: %v", err)
+				c.JSON(500, gin.H{
+					"error": "Internal server error",
+				})
+				return
+			}
+		}
+		if deleteGame {
 			err = game.Delete(db)
 			if err != nil {
 				if err == gorm.ErrRecordNotFound {
@@ -270,7 +337,7 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 				})
 				return
 			}
-			websocket.SendGameDeleteMessage(gameID)
+			websocket.GameDeleted(gameID)
 		} else {
 			err = game.Leave(db, session.ID)
 			if err != nil {
@@ -292,6 +359,7 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 				})
 				return
 			}
+			websocket.PresenceInstance.Remove(gameID, session.ID)
 		}
 
 		utils.Logger.Infof("User with session ID: %s left game with ID: %s", session.SessionID, gameID)
@@ -303,6 +371,467 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 		})
 	})
 
+	router.POST("/api/games/:game_id/settings", func(c *gin.Context) {
+		session, ok := getSessionFromContext(c)
+		if !ok {
+			return
+		}
+		var requestBody services.SettingsUpdate
+		if err := c.ShouldBindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{
+				"error": "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+		gameID := c.Param("game_id")
+		err := websocket.UpdateSettings(db, gameID, session.ID, requestBody)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(404, gin.H{
+					"error": "Game not found",
+				})
+				return
+			}
+			if err.Error() == "user is not in the game" {
+				c.JSON(400, gin.H{
+					"error": "You are not in the game",
+				})
+				return
+			}
+			if err.Error() == "user is not the host" {
+				c.JSON(403, gin.H{
+					"error": "Only the host can change the settings",
+				})
+				return
+			}
+			var actionErr *services.ActionError
+			if errors.As(err, &actionErr) {
+				c.JSON(409, gin.H{
+					"error": "Settings can only be changed in the lobby",
+				})
+				return
+			}
+			var settingsErr *services.SettingsError
+			if errors.As(err, &settingsErr) {
+				c.JSON(400, gin.H{
+					"error": "Invalid game settings: " + settingsErr.Error(),
+				})
+				return
+			}
+			utils.Logger.Errorf("Error updating game settings: %v", err)
+			c.JSON(500, gin.H{
+				"error": "Internal server error",
+			})
+			return
+		}
+
+		utils.Logger.Infof("User with session ID: %s updated settings of game with ID: %s", session.SessionID, gameID)
+		c.JSON(200, gin.H{
+			"message": "Settings updated successfully",
+			"data": gin.H{
+				"game_id": gameID,
+			},
+		})
+	})
+
+	removeMember := func(ban bool) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			session, ok := getSessionFromContext(c)
+			if !ok {
+				return
+			}
+			type removeMemberRequest struct {
+				UserID string `json:"user_id"`
+			}
+			var requestBody removeMemberRequest
+			if err := c.ShouldBindJSON(&requestBody); err != nil {
+				c.JSON(400, gin.H{
+					"error": "Invalid request body: " + err.Error(),
+				})
+				return
+			}
+			targetID, err := uuid.Parse(requestBody.UserID)
+			if err != nil {
+				c.JSON(400, gin.H{
+					"error": "User ID is invalid",
+				})
+				return
+			}
+			gameID := c.Param("game_id")
+			err = websocket.RemoveMember(db, gameID, session.ID, datatypes.UUID(targetID), ban)
+			if err != nil {
+				if err == gorm.ErrRecordNotFound {
+					c.JSON(404, gin.H{
+						"error": "Game not found",
+					})
+					return
+				}
+				if err == services.ErrNotHost {
+					c.JSON(403, gin.H{
+						"error": "Only the host can remove players",
+					})
+					return
+				}
+				if err == services.ErrNotInGame {
+					c.JSON(400, gin.H{
+						"error": "User is not in the game",
+					})
+					return
+				}
+				if err == services.ErrCannotKickHost {
+					c.JSON(400, gin.H{
+						"error": "The host cannot be removed",
+					})
+					return
+				}
+				utils.Logger.Errorf("Error removing user from game: %v", err)
+				c.JSON(500, gin.H{
+					"error": "Internal server error",
+				})
+				return
+			}
+
+			utils.Logger.Infof("User with session ID: %s removed user %s from game with ID: %s", session.SessionID, targetID, gameID)
+			c.JSON(200, gin.H{
+				"message": "User removed successfully",
+				"data": gin.H{
+					"game_id": gameID,
+					"user_id": targetID,
+					"banned":  ban,
+				},
+			})
+		}
+	}
+
+	router.POST("/api/games/:game_id/kick", removeMember(false))
+	router.POST("/api/games/:game_id/ban", removeMember(true))
+
+	router.POST("/api/games/:game_id/lock", func(c *gin.Context) {
+		session, ok := getSessionFromContext(c)
+		if !ok {
+			return
+		}
+		type lockRequest struct {
+			Locked bool `json:"locked"`
+		}
+		var requestBody lockRequest
+		if err := c.ShouldBindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{
+				"error": "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+		gameID := c.Param("game_id")
+		err := websocket.SetLocked(db, gameID, session.ID, requestBody.Locked)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(404, gin.H{
+					"error": "Game not found",
+				})
+				return
+			}
+			if err == services.ErrNotInGame {
+				c.JSON(400, gin.H{
+					"error": "You are not in the game",
+				})
+				return
+			}
+			if err == services.ErrNotHost {
+				c.JSON(403, gin.H{
+					"error": "Only the host can lock the game",
+				})
+				return
+			}
+			utils.Logger.Errorf("Error locking game: %v", err)
+			c.JSON(500, gin.H{
+				"error": "Internal server error",
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"message": "Game lock updated successfully",
+			"data": gin.H{
+				"game_id": gameID,
+				"locked":  requestBody.Locked,
+			},
+		})
+	})
+
+	router.POST("/api/games/:game_id/rematch", func(c *gin.Context) {
+		session, ok := getSessionFromContext(c)
+		if !ok {
+			return
+		}
+		gameID := c.Param("game_id")
+		err := websocket.Rematch(db, gameID, session.ID)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(404, gin.H{
+					"error": "Game not found",
+				})
+				return
+			}
+			if err.Error() == "user is not in the game" {
+				c.JSON(400, gin.H{
+					"error": "You are not in the game",
+				})
+				return
+			}
+			if err.Error() == "user is not the host" {
+				c.JSON(403, gin.H{
+					"error": "Only the host can start a rematch",
+				})
+				return
+			}
+			var actionErr *services.ActionError
+			var transitionErr *services.TransitionError
+			if errors.As(err, &actionErr) || errors.As(err, &transitionErr) {
+				c.JSON(409, gin.H{
+					"error": "Game is not finished",
+				})
+				return
+			}
+			utils.Logger.Errorf("Error resetting game for rematch: %v", err)
+			c.JSON(500, gin.H{
+				"error": "Internal server error",
+			})
+			return
+		}
+
+		utils.Logger.Infof("User with session ID: %s started a rematch in game with ID: %s", session.SessionID, gameID)
+		c.JSON(200, gin.H{
+			"message": "Game reset for rematch",
+			"data": gin.H{
+				"game_id": gameID,
+			},
+		})
+	})
+
+	router.POST("/api/games/:game_id/start", func(c *gin.Context) {
+		session, ok := getSessionFromContext(c)
+		if !ok {
+			return
+		}
+		gameID := c.Param("game_id")
+		round, err := services.StartRound(db, gameID, session.ID)
+		if err != nil {
+			respondActionError(c, err, "Error starting round")
+			return
+		}
+
+		utils.Logger.Infof("User with session ID: %s started round %d in game with ID: %s", session.SessionID, round.Number, gameID)
+		c.JSON(200, gin.H{
+			"message": "Round started",
+			"data": gin.H{
+				"game_id": gameID,
+				"round":   round.Number,
+			},
+		})
+	})
+
+	router.POST("/api/games/:game_id/answers", func(c *gin.Context) {
+		session, ok := getSessionFromContext(c)
+		if !ok {
+			return
+		}
+		type answerRequest struct {
+			Answer string `json:"answer"`
+		}
+		var requestBody answerRequest
+		if err := c.ShouldBindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{
+				"error": "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+		gameID := c.Param("game_id")
+		answer, err := services.SubmitAnswer(db, gameID, session.ID, requestBody.Answer)
+		if err != nil {
+			respondActionError(c, err, "Error adding answer")
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"message": "Answer saved",
+			"data": gin.H{
+				"game_id": gameID,
+				"answer":  answer.View(),
+			},
+		})
+	})
+
+	router.POST("/api/games/:game_id/votes", func(c *gin.Context) {
+		session, ok := getSessionFromContext(c)
+		if !ok {
+			return
+		}
+		type voteRequest struct {
+			TargetUserID string `json:"target_user_id"`
+		}
+		var requestBody voteRequest
+		if err := c.ShouldBindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{
+				"error": "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+		targetID, err := uuid.Parse(requestBody.TargetUserID)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"error": "User ID is invalid",
+			})
+			return
+		}
+		gameID := c.Param("game_id")
+		vote, err := services.CastVote(db, gameID, session.ID, datatypes.UUID(targetID))
+		if err != nil {
+			respondActionError(c, err, "Error voting")
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"message": "Vote saved",
+			"data": gin.H{
+				"game_id": gameID,
+				"vote":    vote,
+			},
+		})
+	})
+
+	router.POST("/api/games/:game_id/chat", func(c *gin.Context) {
+		session, ok := getSessionFromContext(c)
+		if !ok {
+			return
+		}
+		type chatRequest struct {
+			Text string `json:"text"`
+		}
+		var requestBody chatRequest
+		if err := c.ShouldBindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{
+				"error": "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+		gameID := c.Param("game_id")
+		chatMessage, err := websocket.SendChat(db, gameID, session.ID, requestBody.Text)
+		if err != nil {
+			respondActionError(c, err, "Error sending chat message")
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"message": "Chat message sent",
+			"data": gin.H{
+				"game_id":      gameID,
+				"chat_message": chatMessage,
+			},
+		})
+	})
+
+	router.POST("/api/games/:game_id/guess", func(c *gin.Context) {
+		session, ok := getSessionFromContext(c)
+		if !ok {
+			return
+		}
+		type guessRequest struct {
+			Guess string `json:"guess"`
+		}
+		var requestBody guessRequest
+		if err := c.ShouldBindJSON(&requestBody); err != nil {
+			c.JSON(400, gin.H{
+				"error": "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+		gameID := c.Param("game_id")
+		lastChance, err := websocket.SubmitGuess(db, gameID, session.ID, requestBody.Guess)
+		if err != nil {
+			respondActionError(c, err, "Error submitting guess")
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"message": "Guess submitted",
+			"data": gin.H{
+				"game_id":     gameID,
+				"last_chance": lastChance,
+			},
+		})
+	})
+
+	router.POST("/api/games/:game_id/judge-guess", func(c *gin.Context) {
+		session, ok := getSessionFromContext(c)
+		if !ok {
+			return
+		}
+		type judgeGuessRequest struct {
+			Correct *bool `json:"correct"`
+		}
+		var requestBody judgeGuessRequest
+		if err := c.ShouldBindJSON(&requestBody); err != nil || requestBody.Correct == nil {
+			c.JSON(400, gin.H{
+				"error": "Invalid request body: correct must be true or false",
+			})
+			return
+		}
+		gameID := c.Param("game_id")
+		lastChance, err := websocket.JudgeGuess(db, gameID, session.ID, *requestBody.Correct)
+		if err != nil {
+			respondActionError(c, err, "Error judging guess")
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"message": "Guess judged",
+			"data": gin.H{
+				"game_id":     gameID,
+				"last_chance": lastChance,
+			},
+		})
+	})
+
+	router.GET("/api/games/:game_id/state", func(c *gin.Context) {
+		session, ok := getSessionFromContext(c)
+		if !ok {
+			return
+		}
+		gameID := c.Param("game_id")
+		snapshot, err := websocket.GetState(db, gameID, session.ID)
+		if err != nil {
+			respondActionError(c, err, "Error fetching game state")
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": snapshot,
+		})
+	})
+
+	// Only the host may look at the traffic of their game
+	router.GET("/api/games/:game_id/metrics", func(c *gin.Context) {
+		session, ok := getSessionFromContext(c)
+		if !ok {
+			return
+		}
+		gameID := c.Param("game_id")
+		game, err := services.GetGameByID(db, gameID)
+		if err != nil {
+			respondActionError(c, err, "Error fetching game")
+			return
+		}
+		err = game.RequireHost(db, session.ID)
+		if err != nil {
+			respondActionError(c, err, "Error fetching game metrics")
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": websocket.MetricsInstance.Game(gameID),
+		})
+	})
+
 	// update username
 	router.POST("/api/user", func(c *gin.Context) {
 		session, ok := getSessionFromContext(c)
@@ -404,6 +933,20 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 		})
 	})
 
+	router.GET("/api/scoring-modes", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"data": gin.H{
+				"scoring_modes": services.GetAvailableScoringModes(),
+			},
+		})
+	})
+
+	router.GET("/api/metrics", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"data": websocket.MetricsInstance.Snapshot(),
+		})
+	})
+
 	router.GET("/api/categories", func(c *gin.Context) {
 		categories, err := services.GetAvailableCategories()
 		if err != nil {
@@ -420,10 +963,12 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 		})
 	})
 
-	router.GET("/api/games/:game_id", func(c *gin.Context) {
+	// prepareSubscription checks that the user may follow the game and reads
+	// the optional sequence number to resume from
+	prepareSubscription := func(c *gin.Context) (*services.Session, string, *websocket.ResumePosition, bool) {
 		session, ok := getSessionFromContext(c)
 		if !ok {
-			return
+			return nil, "", nil, false
 		}
 		gameID := c.Param("game_id")
 		game, err := services.GetGameByID(db, gameID)
@@ -432,32 +977,145 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 				c.JSON(404, gin.H{
 					"error": "Game not found",
 				})
-				return
+				return nil, "", nil, false
 			}
 			utils.Logger.Errorf("Error fetching game: %v", err)
 			c.JSON(500, gin.H{
 				"error": "Internal server error",
 			})
-			return
+			return nil, "", nil, false
 		}
 		// check if user is in game
-		_, err = game.IsUserInGame(db, session.ID)
+		inGame, err := game.IsUserInGame(db, session.ID)
+		if err != nil {
+			utils.Logger.Errorf("Error checking user in game: %v", err)
+			c.JSON(500, gin.H{
+				"error": "Internal server error",
+			})
+			return nil, "", nil, false
+		}
+		if !inGame {
+			c.JSON(403, gin.H{
+				"error": "You are not in this game",
+			})
+			return nil, "", nil, false
+		}
+
+		// clients that reconnect may resume after the last message they saw,
+		// browsers reconnecting an event stream send it as Last-Event-ID
+		var resume *websocket.ResumePosition
+		since := c.GetHeader("Last-Event-ID")
+		if since == "" {
+			since = c.Query("since")
+		}
+		if since != "" {
+			resume, err = websocket.ParseResumePosition(since)
+			if err != nil {
+				c.JSON(400, gin.H{
+					"error": "since must be a sequence number",
+				})
+				return nil, "", nil, false
+			}
+			if resume.Epoch == "" {
+				resume.Epoch = c.Query("epoch")
+			}
+		}
+
+		return session, gameID, resume, true
+	}
+
+	router.GET("/api/games/:game_id", func(c *gin.Context) {
+		session, gameID, resume, ok := prepareSubscription(c)
+		if !ok {
+			return
+		}
+
+		// older clients announce the message format they speak
+		protocol := websocket.ProtocolCurrent
+		if c.Query("protocol") != "" {
+			version, err := strconv.Atoi(c.Query("protocol"))
+			if err != nil || version < websocket.ProtocolLegacy || version > websocket.ProtocolCurrent {
+				c.JSON(400, gin.H{
+					"error": "Unsupported protocol version",
+				})
+				return
+			}
+			protocol = version
+		}
+
+		// connect to websocket
+		connection, err := websocket.NewConnection(c.Writer, c.Request, nil)
+		if err != nil {
+			utils.Logger.Errorf("Error creating websocket connection: %v", err)
+			c.JSON(500, gin.H{
+				"error": "Internal server error",
+			})
+			return
+		}
+		connection.Protocol = protocol
+		websocket.Subscribe(db, gameID, session.ID, session.Username, connection, resume)
+
+		go connection.ReadPump(db, gameID)
+		go connection.WritePump()
+		utils.Logger.Infof("WebSocket connection established for game ID: %s", gameID)
+
+	})
+
+	// Server-Sent Events fallback for networks that block websockets. Actions
+	// are sent through the REST endpoints.
+	router.GET("/api/games/:game_id/events", func(c *gin.Context) {
+		session, gameID, resume, ok := prepareSubscription(c)
+		if !ok {
+			return
+		}
+
+		connection := websocket.NewSSEConnection()
+		websocket.Subscribe(db, gameID, session.ID, session.Username, connection, resume)
+		utils.Logger.Infof("Event stream established for game ID: %s", gameID)
+
+		connection.Serve(db, c.Writer, c.Request.Context().Done())
+		utils.Logger.Infof("Event stream closed for game ID: %s", gameID)
+	})
+
+	// Read-only connection for viewers of a streamed game. Viewers may vote
+	// during the voting phase and get batched audience tallies.
+	router.GET("/api/games/:game_id/audience", func(c *gin.Context) {
+		gameID := c.Param("game_id")
+		_, err := services.GetGameByID(db, gameID)
 		if err != nil {
 			if err == gorm.ErrRecordNotFound {
-				c.JSON(403, gin.H{
-					"error": "You are not in this game",
+				c.JSON(404, gin.H{
+					"error": "Game not found",
 				})
 				return
 			}
-			utils.Logger.Errorf("Error checking user in game: %v", err)
+			utils.Logger.Errorf("Error fetching game: %v", err)
 			c.JSON(500, gin.H{
 				"error": "Internal server error",
 			})
 			return
 		}
 
-		// connect to websocket
-		connection, err := websocket.NewConnection(c.Writer, c.Request)
+		// viewers keep their ID in a cookie so each of them has one vote,
+		// whichever network they share and however often they reconnect
+		var responseHeader http.Header
+		cookie, _ := c.Cookie("viewer_id")
+		viewerID, err := uuid.Parse(cookie)
+		if err != nil {
+			viewerID = uuid.New()
+			responseHeader = http.Header{}
+			responseHeader.Add("Set-Cookie", (&http.Cookie{
+				Name:     "viewer_id",
+				Value:    viewerID.String(),
+				MaxAge:   72 * 60 * 60,
+				Path:     "/",
+				Domain:   cfg.Host,
+				Secure:   cfg.Secure,
+				HttpOnly: true,
+			}).String())
+		}
+
+		connection, err := websocket.NewConnection(c.Writer, c.Request, responseHeader)
 		if err != nil {
 			utils.Logger.Errorf("Error creating websocket connection: %v", err)
 			c.JSON(500, gin.H{
@@ -465,16 +1123,18 @@ func Initialize(db *gorm.DB, cfg *config.Config) {
 			})
 			return
 		}
-		websocket.HubInstance.AddConnection(gameID, connection, session.ID)
+		connection.GameID = gameID
+		connection.UserID = datatypes.UUID(viewerID)
 
-		websocket.SendInitMessage(gameID, session.ID, db)
-		websocket.SendJoinMessage(gameID, session.ID, session.Username)
-		websocket.SendUserStatusMessage(gameID, session.ID, true)
+		err = websocket.SendAudienceInitMessage(db, gameID, connection)
+		if err != nil {
+			utils.Logger.Errorf("Error sending audience init message: %v", err)
+		}
+		websocket.AudienceInstance.Add(gameID, connection)
 
-		go connection.ReadPump(db, websocket.HubInstance, gameID)
+		go connection.AudienceReadPump(gameID, viewerID.String())
 		go connection.WritePump()
-		utils.Logger.Infof("WebSocket connection established for game ID: %s", gameID)
-
+		utils.Logger.Debugf("Audience connection established for game ID: %s", gameID)
 	})
 
 	router.GET("/api/user/id", func(c *gin.Context) {
@@ -513,3 +1173,55 @@ func getSessionFromContext(c *gin.Context) (*services.Session, bool) {
 
 	return session, true
 }
+
+// respondActionError maps the errors of in-game actions to HTTP responses.
+func respondActionError(c *gin.Context, err error, logMessage string) {
+	var actionErr *services.ActionError
+	var transitionErr *services.TransitionError
+	var settingsErr *services.SettingsError
+
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		c.JSON(404, gin.H{
+			"error": "Game not found",
+		})
+	case err == services.ErrNotInGame:
+		c.JSON(403, gin.H{
+			"error": "You are not in this game",
+		})
+	case err == services.ErrNotHost:
+		c.JSON(403, gin.H{
+			"error": "Only the host can do this",
+		})
+	case err == services.ErrSpectator:
+		c.JSON(403, gin.H{
+			"error": "Spectators cannot play this round",
+		})
+	case err == services.ErrNotGuesser:
+		c.JSON(403, gin.H{
+			"error": err.Error(),
+		})
+	case errors.As(err, &actionErr), errors.As(err, &transitionErr),
+		err == services.ErrNoRoundsLeft, err == services.ErrAnsweringClosed,
+		err == services.ErrAlreadyGuessed, err == services.ErrGuessingClosed,
+		err == services.ErrNoGuess, err == services.ErrGuessAlreadyJudged:
+		c.JSON(409, gin.H{
+			"error": err.Error(),
+		})
+	case err == services.ErrChatRateLimited:
+		c.JSON(429, gin.H{
+			"error": err.Error(),
+		})
+	case errors.As(err, &settingsErr), err == services.ErrInvalidVoteTarget, err == services.ErrVoteTargetNotInGame,
+		err == services.ErrChatEmpty, err == services.ErrChatTooLong,
+		err == services.ErrGuessEmpty, err == services.ErrGuessTooLong:
+		c.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		utils.Logger.Errorf("%s: %v", logMessage, err)
+		c.JSON(500, gin.H{
+			"error": "Internal server error",
+		})
+	}
+}
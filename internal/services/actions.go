@@ -0,0 +1,138 @@
+package services
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Actions in this file are shared by the websocket handlers and the REST API
+// so both validate the same way. Whatever has to be told to the players is
+// left to the hooks registered below.
+
+// RoundStartedHook runs once a round opened. Promoted are the spectators that
+// play from this round on.
+type RoundStartedHook func(db *gorm.DB, game *Game, round *Round, impostors []GameMember, promoted []GameMember)
+
+// AnswerHook runs once a player answered.
+type AnswerHook func(db *gorm.DB, game *Game, answer *Answer)
+
+// VoteHook runs once a player voted.
+type VoteHook func(db *gorm.DB, game *Game, vote *Vote)
+
+var (
+	roundStartedHooks []RoundStartedHook
+	answerHooks       []AnswerHook
+	voteHooks         []VoteHook
+)
+
+// AbsentUsers reports the members of a game that are gone and should not be
+// picked as impostors. It is set by whatever tracks the connections.
+var AbsentUsers = func(gameID string) []datatypes.UUID {
+	return nil
+}
+
+// OnRoundStarted registers a hook that runs after every round start.
+func OnRoundStarted(hook RoundStartedHook) {
+	roundStartedHooks = append(roundStartedHooks, hook)
+}
+
+// OnAnswer registers a hook that runs after every answer.
+func OnAnswer(hook AnswerHook) {
+	answerHooks = append(answerHooks, hook)
+}
+
+// OnVote registers a hook that runs after every vote.
+func OnVote(hook VoteHook) {
+	voteHooks = append(voteHooks, hook)
+}
+
+// RequireHost fails unless the user is the host of the game.
+func (game *Game) RequireHost(db *gorm.DB, userID datatypes.UUID) error {
+	isHost, err := game.IsHost(db, userID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrNotInGame
+		}
+		return err
+	}
+	if !isHost {
+		return ErrNotHost
+	}
+
+	return nil
+}
+
+// StartRound lets the host open the next round.
+func StartRound(db *gorm.DB, gameID string, userID datatypes.UUID) (*Round, error) {
+	game, err := GetGameByID(db, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = game.RequireHost(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		return nil, err
+	}
+
+	spectators, err := game.GetSpectators(db)
+	if err != nil {
+		return nil, err
+	}
+
+	answersEnd := Clock.Now().Add(time.Duration(settings.AnswerSeconds) * time.Second)
+	round, impostors, err := game.StartRound(db, settings, answersEnd, AbsentUsers(gameID))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hook := range roundStartedHooks {
+		hook(db, game, round, impostors, spectators)
+	}
+
+	return round, nil
+}
+
+// SubmitAnswer stores the answer of a player.
+func SubmitAnswer(db *gorm.DB, gameID string, userID datatypes.UUID, answer string) (*Answer, error) {
+	game, err := GetGameByID(db, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	answerObj, err := game.AddAnswer(db, userID, answer)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hook := range answerHooks {
+		hook(db, game, answerObj)
+	}
+
+	return answerObj, nil
+}
+
+// CastVote stores the vote of a player.
+func CastVote(db *gorm.DB, gameID string, userID datatypes.UUID, targetID datatypes.UUID) (*Vote, error) {
+	game, err := GetGameByID(db, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	voteObj, err := game.Vote(db, userID, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hook := range voteHooks {
+		hook(db, game, voteObj)
+	}
+
+	return voteObj, nil
+}
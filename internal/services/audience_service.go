@@ -0,0 +1,88 @@
+package services
+
+import (
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// AudienceVote is the number of audience votes a player received in a round.
+// Audience votes are collected in memory and only stored once per round, in
+// aggregate.
+type AudienceVote struct {
+	ID       datatypes.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	RoundID  datatypes.UUID `gorm:"type:uuid;index" json:"round_id"`
+	TargetID datatypes.UUID `gorm:"type:uuid" json:"target_id"`
+	Votes    int            `json:"votes"`
+}
+
+// AudienceVerdict is who the audience singled out in a round. It does not
+// affect the players' scores.
+type AudienceVerdict struct {
+	Votes   int              `json:"votes"`
+	Tally   map[string]int   `json:"tally"`
+	Accused []datatypes.UUID `json:"accused"`
+	Verdict Verdict          `json:"verdict"`
+}
+
+// SaveAudienceTally stores the audience votes of the current round, replacing
+// any tally stored before.
+func (game *Game) SaveAudienceTally(db *gorm.DB, tally map[datatypes.UUID]int) error {
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("round_id = ?", round.ID).Delete(&AudienceVote{}).Error
+		if err != nil {
+			return err
+		}
+
+		for target, votes := range tally {
+			err = tx.Create(&AudienceVote{
+				ID:       datatypes.NewUUIDv4(),
+				RoundID:  round.ID,
+				TargetID: target,
+				Votes:    votes,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// getAudienceVerdict returns the audience verdict of a round, or nil if the
+// audience did not vote.
+func getAudienceVerdict(db *gorm.DB, round *Round, impostors map[datatypes.UUID]bool) (*AudienceVerdict, error) {
+	var audienceVotes []AudienceVote
+	err := db.Where("round_id = ?", round.ID).Find(&audienceVotes).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(audienceVotes) == 0 {
+		return nil, nil
+	}
+
+	tally := make(map[datatypes.UUID]int, len(audienceVotes))
+	verdict := &AudienceVerdict{
+		Tally:   make(map[string]int, len(audienceVotes)),
+		Accused: []datatypes.UUID{},
+		Verdict: VerdictEscaped,
+	}
+	for _, audienceVote := range audienceVotes {
+		tally[audienceVote.TargetID] = audienceVote.Votes
+		verdict.Tally[audienceVote.TargetID.String()] = audienceVote.Votes
+		verdict.Votes += audienceVote.Votes
+	}
+
+	if targets := pluralityTargets(tally); len(targets) == 1 {
+		verdict.Accused = targets
+		if impostors[targets[0]] {
+			verdict.Verdict = VerdictCaught
+		}
+	}
+
+	return verdict, nil
+}
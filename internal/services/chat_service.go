@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	MaxChatLength = 300
+	// Players may send at most ChatRateLimit messages per ChatRateWindow
+	ChatRateLimit  = 5
+	ChatRateWindow = 10 * time.Second
+	// ChatHistoryLength is how many messages new connections get replayed
+	ChatHistoryLength = 100
+)
+
+var (
+	ErrChatEmpty       = errors.New("chat message is empty")
+	ErrChatTooLong     = errors.New("chat message is too long")
+	ErrChatRateLimited = errors.New("too many chat messages, slow down")
+)
+
+type ChatMessage struct {
+	ID        datatypes.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	CreatedAt time.Time      `gorm:"index" json:"created_at"`
+	GameID    string         `gorm:"index" json:"game_id"`
+	UserID    datatypes.UUID `gorm:"type:uuid;index" json:"user_id"`
+	Round     int            `json:"round"`
+	Text      string         `json:"text"`
+}
+
+// roundRunning reports whether players are in the middle of a round.
+func (game *Game) roundRunning() bool {
+	switch game.State {
+	case GameStateAnswering, GameStateDiscussion, GameStateVoting, GameStateGuessing:
+		return true
+	default:
+		return false
+	}
+}
+
+// AddChatMessage stores a chat message of a member. Spectators may only chat
+// between rounds unless the host allowed spectator chat.
+func (game *Game) AddChatMessage(db *gorm.DB, userID datatypes.UUID, text string) (*ChatMessage, error) {
+	err := game.CanPerform(ActionChat)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := game.GetMember(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if member.Role == MemberRoleSpectator && game.roundRunning() {
+		settings, err := game.GetSettings(db)
+		if err != nil {
+			return nil, err
+		}
+		if !settings.SpectatorChat {
+			return nil, ErrSpectator
+		}
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrChatEmpty
+	}
+	if utf8.RuneCountInString(text) > MaxChatLength {
+		return nil, ErrChatTooLong
+	}
+
+	var recent int64
+	err = db.Model(&ChatMessage{}).
+		Where("game_id = ? AND user_id = ? AND created_at > ?", game.ID, userID, time.Now().Add(-ChatRateWindow)).
+		Count(&recent).Error
+	if err != nil {
+		return nil, err
+	}
+	if recent >= ChatRateLimit {
+		return nil, ErrChatRateLimited
+	}
+
+	chatMessage := &ChatMessage{
+		ID:     datatypes.NewUUIDv4(),
+		GameID: game.ID,
+		UserID: userID,
+		Round:  game.CurrentRound,
+		Text:   text,
+	}
+	err = db.Create(chatMessage).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return chatMessage, nil
+}
+
+// GetChatMessages returns the latest chat messages of the game, oldest first.
+func (game *Game) GetChatMessages(db *gorm.DB) ([]ChatMessage, error) {
+	var chatMessages []ChatMessage
+	err := db.Where("game_id = ?", game.ID).Order("created_at desc").Limit(ChatHistoryLength).Find(&chatMessages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(chatMessages)-1; i < j; i, j = i+1, j-1 {
+		chatMessages[i], chatMessages[j] = chatMessages[j], chatMessages[i]
+	}
+	return chatMessages, nil
+}
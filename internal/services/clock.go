@@ -0,0 +1,8 @@
+package services
+
+import "github.com/OddOneOutApp/backend/internal/services/timers"
+
+// Clock is the time every phase deadline is set and checked against. Tests
+// may replace it before the websocket package is initialised to fast-forward
+// through a game.
+var Clock timers.Clock = timers.RealClock{}
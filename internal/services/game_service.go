@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,17 +12,21 @@ import (
 )
 
 type Game struct {
-	ID              string       `gorm:"primaryKey" json:"id"`
-	CreatedAt       time.Time    `json:"created_at"`
-	UpdatedAt       time.Time    `json:"updated_at"`
-	Category        string       `gorm:"index" json:"category"`
-	RegularQuestion string       `json:"regular_question"`
-	SneakyQuestion  string       `json:"sneaky_question"`
-	AnswersEndTime  time.Time    `json:"answers_end_time"`
-	VotingEndTime   time.Time    `json:"voting_end_time"`
-	State           GameState    `gorm:"default:'lobby'" json:"state"`
-	GameMembers     []GameMember `gorm:"foreignKey:GameID;constraint:OnDelete:CASCADE" json:"game_members"`
-	Answers         []Answer     `gorm:"foreignKey:GameID;constraint:OnDelete:CASCADE" json:"answers"`
+	ID                string       `gorm:"primaryKey" json:"id"`
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+	RegularQuestion   string       `json:"regular_question"`
+	SneakyQuestion    string       `json:"sneaky_question"`
+	AnswersEndTime    time.Time    `json:"answers_end_time"`
+	DiscussionEndTime time.Time    `json:"discussion_end_time"`
+	VotingEndTime     time.Time    `json:"voting_end_time"`
+	GuessEndTime      time.Time    `json:"guess_end_time"`
+	State             GameState    `gorm:"default:'lobby'" json:"state"`
+	CurrentRound      int          `json:"current_round"`
+	Locked            bool         `json:"locked"`
+	GameMembers       []GameMember `gorm:"foreignKey:GameID;constraint:OnDelete:CASCADE" json:"game_members"`
+	Rounds            []Round      `gorm:"foreignKey:GameID;constraint:OnDelete:CASCADE" json:"rounds"`
+	Answers           []Answer     `gorm:"foreignKey:GameID;constraint:OnDelete:CASCADE" json:"answers"`
 }
 
 type GameMember struct {
@@ -33,27 +38,68 @@ type GameMember struct {
 	Host      bool           `json:"host"`
 	Impostor  bool           `json:"impostor"`
 	Vote      datatypes.UUID `gorm:"type:uuid;index" json:"vote"`
+	Score     int            `json:"score"`
+	Role      MemberRole     `gorm:"default:player" json:"role"`
 }
 
+// MemberRole tells whether a member takes part in the current round.
+type MemberRole string
+
+const (
+	MemberRolePlayer    MemberRole = "player"
+	MemberRoleSpectator MemberRole = "spectator" // Joined mid-game, plays from the next round on
+)
+
 type Answer struct {
 	ID        datatypes.UUID `gorm:"type:uuid;primaryKey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	GameID    string         `gorm:"index" json:"game_id"`
-	UserID    datatypes.UUID `gorm:"type:uuid;index" json:"user_id"`
+	RoundID   datatypes.UUID `gorm:"type:uuid;uniqueIndex:idx_answers_round_user" json:"round_id"` // One answer per player per round
+	UserID    datatypes.UUID `gorm:"type:uuid;index;uniqueIndex:idx_answers_round_user" json:"user_id"`
 	Answer    string         `json:"answer"`
+	Archived  bool           `gorm:"index" json:"archived"`
+}
+
+// AnswerView is how an answer is handed back to the player who gave it.
+type AnswerView struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	Answer string `json:"answer"`
 }
 
+func (answer *Answer) View() AnswerView {
+	return AnswerView{
+		ID:     answer.ID.String(),
+		UserID: answer.UserID.String(),
+		Answer: answer.Answer,
+	}
+}
+
+var (
+	ErrNotInGame           = errors.New("user is not in the game")
+	ErrNotHost             = errors.New("user is not the host")
+	ErrNoRoundsLeft        = errors.New("all rounds have been played")
+	ErrInvalidVoteTarget   = errors.New("vote target did not answer this round")
+	ErrVoteTargetNotInGame = errors.New("vote target is not in the game")
+	ErrAnsweringClosed     = errors.New("answering time is over")
+	ErrNoMembersLeft       = errors.New("no members left to take over")
+	ErrSpectator           = errors.New("spectators cannot play this round")
+)
+
 type GameState string
 
 const (
-	GameStateLobby     GameState = "lobby"
-	GameStateAnswering GameState = "answering"
-	GameStateVoting    GameState = "voting"
-	GameStateFinished  GameState = "finished"
+	GameStateLobby      GameState = "lobby"
+	GameStateAnswering  GameState = "answering"
+	GameStateDiscussion GameState = "discussion"
+	GameStateVoting     GameState = "voting"
+	GameStateGuessing   GameState = "guessing" // A caught impostor guesses the real question
+	GameStateRoundEnd   GameState = "round_end"
+	GameStateFinished   GameState = "finished"
 )
 
-func CreateGame(db *gorm.DB, cfg *config.Config, hostID datatypes.UUID, category string) (*Game, error) {
+func CreateGame(db *gorm.DB, cfg *config.Config, hostID datatypes.UUID, category string, rounds int, scoringMode string) (*Game, error) {
 	// Check if user is already in a game
 	var existingMember GameMember
 	result := db.Where("user_id = ?", hostID).First(&existingMember)
@@ -65,16 +111,27 @@ func CreateGame(db *gorm.DB, cfg *config.Config, hostID datatypes.UUID, category
 		return nil, result.Error
 	}
 
+	settingsObj := newGameSettings(category, rounds, scoringMode)
+	err := settingsObj.Validate()
+	if err != nil {
+		return nil, err
+	}
+
 	// User not in a game, create new game
 	gameObj := &Game{
 		ID:             random.RandomString(4),
-		Category:       category,
 		State:          GameStateLobby,
 		AnswersEndTime: time.Unix(0, 0).UTC(),
 		VotingEndTime:  time.Unix(0, 0).UTC(),
 	}
 
-	err := db.Create(gameObj).Error
+	err = db.Create(gameObj).Error
+	if err != nil {
+		return nil, err
+	}
+
+	settingsObj.GameID = gameObj.ID
+	err = db.Create(settingsObj).Error
 	if err != nil {
 		return nil, err
 	}
@@ -115,15 +172,33 @@ func (game *Game) Join(db *gorm.DB, userID datatypes.UUID) (*GameMember, error)
 		return nil, result.Error
 	}
 
+	banned, err := game.IsBanned(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if banned {
+		return nil, ErrBanned
+	}
+	if game.Locked {
+		return nil, ErrGameLocked
+	}
+
+	// Players joining a running game watch until the next round starts
+	role := MemberRolePlayer
+	if game.State != GameStateLobby {
+		role = MemberRoleSpectator
+	}
+
 	// User not in the game, create new member
 	gameMemberObj := &GameMember{
 		ID:     datatypes.NewUUIDv4(),
 		GameID: game.ID,
 		UserID: userID,
 		Host:   false,
+		Role:   role,
 	}
 
-	err := db.Create(gameMemberObj).Error
+	err = db.Create(gameMemberObj).Error
 	if err != nil {
 		return nil, err
 	}
@@ -131,21 +206,16 @@ func (game *Game) Join(db *gorm.DB, userID datatypes.UUID) (*GameMember, error)
 	return gameMemberObj, nil
 }
 
-func (game *Game) SetAnswersEndTimeAndGameState(db *gorm.DB, endTime time.Time) error {
-	game.AnswersEndTime = endTime
-	game.State = GameStateAnswering
-	err := db.Save(game).Error
-	if err != nil {
-		return err
-	}
-
-	return nil
+// SetDiscussionEndTimeAndGameState opens the discussion between answering and
+// voting.
+func (game *Game) SetDiscussionEndTimeAndGameState(db *gorm.DB, endTime time.Time) error {
+	game.DiscussionEndTime = endTime
+	return game.TransitionTo(db, GameStateDiscussion, "discussion_end_time")
 }
 
 func (game *Game) SetVotingEndTimeAndGameState(db *gorm.DB, endTime time.Time) error {
 	game.VotingEndTime = endTime
-	game.State = GameStateVoting
-	err := db.Save(game).Error
+	err := game.TransitionTo(db, GameStateVoting, "voting_end_time")
 	if err != nil {
 		return err
 	}
@@ -162,25 +232,70 @@ func (game *Game) Leave(db *gorm.DB, userID datatypes.UUID) error {
 	return nil
 }
 
+// Delete removes the game along with its rounds, answers, votes and
+// everything else kept about it.
 func (game *Game) Delete(db *gorm.DB) error {
-	var gameMembers []GameMember
-	err := db.Where("game_id = ?", game.ID).Find(&gameMembers).Error
+	return db.Transaction(func(tx *gorm.DB) error {
+		rounds := tx.Model(&Round{}).Select("id").Where("game_id = ?", game.ID)
+		err := tx.Where("round_id IN (?)", rounds).Delete(&AudienceVote{}).Error
+		if err != nil {
+			return err
+		}
+
+		// Everything else is keyed by the game
+		for _, model := range []interface{}{&Vote{}, &Answer{}, &Round{}, &GameMember{}, &GameSettings{}, &Ban{}, &ChatMessage{}} {
+			err = tx.Where("game_id = ?", game.ID).Delete(model).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(game).Error
+	})
+}
+
+// Rematch returns a finished game to the lobby so the same players can play
+// again. Answers and rounds of the previous match are archived, not deleted.
+func (game *Game) Rematch(db *gorm.DB) error {
+	err := game.CanPerform(ActionRematch)
 	if err != nil {
 		return err
 	}
 
-	for _, member := range gameMembers {
-		err = db.Delete(&member).Error
+	game.CurrentRound = 0
+	game.RegularQuestion = ""
+	game.SneakyQuestion = ""
+	game.AnswersEndTime = time.Unix(0, 0).UTC()
+	game.DiscussionEndTime = time.Unix(0, 0).UTC()
+	game.VotingEndTime = time.Unix(0, 0).UTC()
+	game.GuessEndTime = time.Unix(0, 0).UTC()
+
+	from := game.State
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Answer{}).Where("game_id = ?", game.ID).Update("archived", true).Error
 		if err != nil {
 			return err
 		}
-	}
 
-	err = db.Delete(game).Error
+		err = tx.Model(&Round{}).Where("game_id = ?", game.ID).Update("archived", true).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&GameMember{}).Where("game_id = ?", game.ID).
+			Updates(map[string]interface{}{"impostor": false, "vote": datatypes.UUID{}, "score": 0, "role": MemberRolePlayer}).Error
+		if err != nil {
+			return err
+		}
+
+		return game.transition(tx, GameStateLobby, "current_round", "regular_question", "sneaky_question",
+			"answers_end_time", "discussion_end_time", "voting_end_time", "guess_end_time")
+	})
 	if err != nil {
 		return err
 	}
 
+	game.runTransitionHooks(db, from)
 	return nil
 }
 
@@ -194,6 +309,81 @@ func (game *Game) GetMembers(db *gorm.DB) ([]GameMember, error) {
 	return gameMembers, nil
 }
 
+func (game *Game) GetMember(db *gorm.DB, userID datatypes.UUID) (*GameMember, error) {
+	var gameMember GameMember
+	err := db.Where("game_id = ? AND user_id = ?", game.ID, userID).First(&gameMember).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotInGame
+		}
+		return nil, err
+	}
+
+	return &gameMember, nil
+}
+
+// GetPlayers returns the members taking part in the current round.
+func (game *Game) GetPlayers(db *gorm.DB) ([]GameMember, error) {
+	return game.getMembersWithRole(db, MemberRolePlayer)
+}
+
+// GetSpectators returns the members waiting for the next round.
+func (game *Game) GetSpectators(db *gorm.DB) ([]GameMember, error) {
+	return game.getMembersWithRole(db, MemberRoleSpectator)
+}
+
+func (game *Game) getMembersWithRole(db *gorm.DB, role MemberRole) ([]GameMember, error) {
+	var gameMembers []GameMember
+	err := db.Where("game_id = ? AND role = ?", game.ID, role).Find(&gameMembers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return gameMembers, nil
+}
+
+// PromoteSpectators turns all spectators into players.
+func (game *Game) PromoteSpectators(db *gorm.DB) error {
+	return db.Model(&GameMember{}).Where("game_id = ? AND role = ?", game.ID, MemberRoleSpectator).
+		Update("role", MemberRolePlayer).Error
+}
+
+// TransferHost hands host ownership to the longest-standing remaining member,
+// preferring members with a live connection.
+func (game *Game) TransferHost(db *gorm.DB, connected []datatypes.UUID) (*GameMember, error) {
+	var candidates []GameMember
+	err := db.Where("game_id = ? AND host = ?", game.ID, false).Order("created_at ASC").Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoMembersLeft
+	}
+
+	newHost := candidates[0]
+	for _, candidate := range candidates {
+		if containsUUID(connected, candidate.UserID) {
+			newHost = candidate
+			break
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&GameMember{}).Where("game_id = ? AND host = ?", game.ID, true).Update("host", false).Error
+		if err != nil {
+			return err
+		}
+
+		newHost.Host = true
+		return tx.Model(&newHost).Update("host", true).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &newHost, nil
+}
+
 func (game *Game) IsHost(db *gorm.DB, userID datatypes.UUID) (bool, error) {
 	var gameMemberObj GameMember
 	err := db.Where("game_id = ? AND user_id = ?", game.ID, userID).First(&gameMemberObj).Error
@@ -218,32 +408,88 @@ func (game *Game) IsUserInGame(db *gorm.DB, userID datatypes.UUID) (bool, error)
 }
 
 func (game *Game) AddAnswer(db *gorm.DB, userID datatypes.UUID, answer string) (*Answer, error) {
+	err := game.CanPerform(ActionAnswer)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if user is already in the game
 	var existingMember GameMember
 	result := db.Where("game_id = ? AND user_id = ?", game.ID, userID).First(&existingMember)
 	if result.Error != nil {
-		return nil, fmt.Errorf("user is not in the game")
+		return nil, ErrNotInGame
+	}
+	if existingMember.Role == MemberRoleSpectator {
+		return nil, ErrSpectator
+	}
+
+	if Clock.Now().After(game.AnswersEndTime) {
+		return nil, ErrAnsweringClosed
+	}
+
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// Players may revise their answer until the answering phase ends
+	var answerObj Answer
+	result = db.Where("round_id = ? AND user_id = ?", round.ID, userID).First(&answerObj)
+	if result.Error == nil {
+		answerObj.Answer = answer
+		err = db.Save(&answerObj).Error
+		if err != nil {
+			return nil, err
+		}
+		return &answerObj, nil
+	} else if result.Error != gorm.ErrRecordNotFound {
+		return nil, result.Error
 	}
 
 	// User is in the game, create new answer
-	answerObj := &Answer{
-		ID:     datatypes.NewUUIDv4(),
-		GameID: game.ID,
-		UserID: userID,
-		Answer: answer,
+	answerObj = Answer{
+		ID:      datatypes.NewUUIDv4(),
+		GameID:  game.ID,
+		RoundID: round.ID,
+		UserID:  userID,
+		Answer:  answer,
 	}
 
-	err := db.Create(answerObj).Error
+	err = db.Create(&answerObj).Error
 	if err != nil {
 		return nil, err
 	}
 
-	return answerObj, nil
+	return &answerObj, nil
+}
+
+// GetAnsweredUserIDs returns the players that submitted an answer in the
+// current round.
+func (game *Game) GetAnsweredUserIDs(db *gorm.DB) ([]datatypes.UUID, error) {
+	answers, err := game.GetAnswers(db)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]datatypes.UUID, 0, len(answers))
+	for _, answer := range answers {
+		userIDs = append(userIDs, answer.UserID)
+	}
+
+	return userIDs, nil
 }
 
 func (game *Game) GetAnswers(db *gorm.DB) ([]Answer, error) {
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return []Answer{}, nil // No round has been started yet
+		}
+		return nil, err
+	}
+
 	var answers []Answer
-	err := db.Where("game_id = ?", game.ID).Find(&answers).Error
+	err = db.Where("game_id = ? AND round_id = ?", game.ID, round.ID).Find(&answers).Error
 	if err != nil {
 		return nil, err
 	}
@@ -251,42 +497,141 @@ func (game *Game) GetAnswers(db *gorm.DB) ([]Answer, error) {
 	return answers, nil
 }
 
-func (game *Game) Vote(db *gorm.DB, userID datatypes.UUID, answerID datatypes.UUID) error {
+func (game *Game) Vote(db *gorm.DB, userID datatypes.UUID, targetID datatypes.UUID) (*Vote, error) {
+	err := game.CanPerform(ActionVote)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if user is already in the game
 	var existingMember GameMember
 	result := db.Where("game_id = ? AND user_id = ?", game.ID, userID).First(&existingMember)
 	if result.Error != nil {
-		return fmt.Errorf("user is not in the game")
+		return nil, ErrNotInGame
+	}
+	if existingMember.Role == MemberRoleSpectator {
+		return nil, ErrSpectator
+	}
+
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		return nil, err
+	}
+
+	inGame, err := game.IsUserInGame(db, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if !inGame {
+		return nil, ErrVoteTargetNotInGame
 	}
 
 	// User is in the game, update vote count for the answer
 	var answerObj Answer
-	err := db.Where("user_id = ? AND game_id = ?", answerID, game.ID).First(&answerObj).Error
+	err = db.Where("user_id = ? AND round_id = ?", targetID, round.ID).First(&answerObj).Error
 	if err != nil {
-		return err
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidVoteTarget
+		}
+		return nil, err
+	}
+
+	var voteObj Vote
+	result = db.Where("round_id = ? AND user_id = ?", round.ID, userID).First(&voteObj)
+	if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
+		return nil, result.Error
+	}
+	if result.Error == gorm.ErrRecordNotFound {
+		voteObj = Vote{
+			ID:      datatypes.NewUUIDv4(),
+			GameID:  game.ID,
+			RoundID: round.ID,
+			UserID:  userID,
+		}
+	}
+	voteObj.TargetID = targetID
+	err = db.Save(&voteObj).Error
+	if err != nil {
+		return nil, err
 	}
 
-	existingMember.Vote = answerID
+	existingMember.Vote = targetID
 	err = db.Save(&existingMember).Error
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &voteObj, nil
+}
+
+// AllMembersAnswered reports whether every player answered the current round.
+// Absent players and spectators are not waited for.
+func (game *Game) AllMembersAnswered(db *gorm.DB, absent []datatypes.UUID) (bool, error) {
+	members, err := game.GetPlayers(db)
+	if err != nil {
+		return false, err
+	}
+
+	answered, err := game.GetAnsweredUserIDs(db)
+	if err != nil {
+		return false, err
+	}
+
+	for _, member := range withoutAbsent(members, absent) {
+		if !containsUUID(answered, member.UserID) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// AllMembersVoted reports whether every player voted in the current round.
+// Absent players and spectators are not waited for.
+func (game *Game) AllMembersVoted(db *gorm.DB, absent []datatypes.UUID) (bool, error) {
+	members, err := game.GetPlayers(db)
+	if err != nil {
+		return false, err
+	}
+
+	votes, err := game.GetVoteResults(db)
+	if err != nil {
+		return false, err
+	}
+
+	for _, member := range withoutAbsent(members, absent) {
+		if _, ok := votes[member.UserID]; !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// withoutAbsent filters the absent players out of a list of members.
+func withoutAbsent(members []GameMember, absent []datatypes.UUID) []GameMember {
+	present := make([]GameMember, 0, len(members))
+	for _, member := range members {
+		if !containsUUID(absent, member.UserID) {
+			present = append(present, member)
+		}
+	}
+	return present
 }
 
 func (game *Game) GetVoteResults(db *gorm.DB) (map[datatypes.UUID]datatypes.UUID, error) {
-	var gameMembers []GameMember
-	err := db.Where("game_id = ?", game.ID).Find(&gameMembers).Error
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var votes []Vote
+	err = db.Where("round_id = ?", round.ID).Find(&votes).Error
 	if err != nil {
 		return nil, err
 	}
 
 	votesMap := make(map[datatypes.UUID]datatypes.UUID)
-	for _, member := range gameMembers {
-		if member.Vote != (datatypes.UUID{}) {
-			votesMap[member.UserID] = member.Vote
-		}
+	for _, vote := range votes {
+		votesMap[vote.UserID] = vote.TargetID
 	}
 
 	return votesMap, nil
@@ -302,12 +647,14 @@ func (game *Game) GetImpostors(db *gorm.DB) ([]GameMember, error) {
 	return impostors, nil
 }
 
-func (game *Game) SelectImpostors(db *gorm.DB, count int) ([]GameMember, error) {
-	var gameMembers []GameMember
-	err := db.Where("game_id = ?", game.ID).Find(&gameMembers).Error
+// SelectImpostors picks count impostors among the players that are not absent.
+// Spectators are never picked.
+func (game *Game) SelectImpostors(db *gorm.DB, count int, absent []datatypes.UUID) ([]GameMember, error) {
+	gameMembers, err := game.GetPlayers(db)
 	if err != nil {
 		return nil, err
 	}
+	gameMembers = withoutAbsent(gameMembers, absent)
 
 	if len(gameMembers) < count {
 		return nil, fmt.Errorf("not enough players to select impostors")
@@ -339,26 +686,34 @@ func (game *Game) IsGameMemberImpostor(db *gorm.DB, userID datatypes.UUID) (bool
 	return gameMember.Impostor, nil
 }
 
+// GetQuestionForUser returns the question a member got this round. Spectators
+// get none.
 func (game *Game) GetQuestionForUser(db *gorm.DB, userID datatypes.UUID) (string, error) {
-	isImpostor, err := game.IsGameMemberImpostor(db, userID)
+	var gameMember GameMember
+	err := db.Where("game_id = ? AND user_id = ?", game.ID, userID).First(&gameMember).Error
 	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return game.RegularQuestion, nil
+		}
 		return "", err
 	}
 
-	if isImpostor {
+	if gameMember.Role == MemberRoleSpectator {
+		return "", nil
+	}
+	if gameMember.Impostor {
 		return game.SneakyQuestion, nil
 	}
 	return game.RegularQuestion, nil
 }
 
 func (game *Game) GetCategory(db *gorm.DB) (string, error) {
-	var gameObj Game
-	err := db.First(&gameObj, "id = ?", game.ID).Error
+	settings, err := game.GetSettings(db)
 	if err != nil {
 		return "", err
 	}
 
-	return gameObj.Category, nil
+	return settings.Category, nil
 }
 
 func (game *Game) GetHost(db *gorm.DB) (*GameMember, error) {
@@ -370,3 +725,12 @@ func (game *Game) GetHost(db *gorm.DB) (*GameMember, error) {
 
 	return &host, nil
 }
+
+func containsUUID(slice []datatypes.UUID, item datatypes.UUID) bool {
+	for _, v := range slice {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// GuessJudging tells who decides whether a last-chance guess is right.
+type GuessJudging string
+
+const (
+	GuessJudgingAuto GuessJudging = "auto" // Compared against the regular question
+	GuessJudgingHost GuessJudging = "host"
+)
+
+const (
+	DefaultGuessSeconds = 30
+	MaxGuessLength      = 300
+	// GuessSimilarityThreshold is how similar two words have to be to count
+	// as the same word when a guess is judged automatically
+	GuessSimilarityThreshold = 0.8
+)
+
+var (
+	ErrNotGuesser         = errors.New("only the caught impostor may guess")
+	ErrAlreadyGuessed     = errors.New("the impostor already guessed")
+	ErrGuessEmpty         = errors.New("guess is empty")
+	ErrGuessTooLong       = errors.New("guess is too long")
+	ErrGuessingClosed     = errors.New("guessing time is over")
+	ErrNoGuess            = errors.New("the impostor has not guessed yet")
+	ErrGuessAlreadyJudged = errors.New("the guess was already judged")
+)
+
+// LastChance is the guess of the real question a caught impostor gets to
+// make after voting.
+type LastChance struct {
+	Impostor datatypes.UUID `json:"impostor"`
+	Guess    string         `json:"guess"`
+	Judged   bool           `json:"judged"`
+	Correct  bool           `json:"correct"`
+	JudgedBy GuessJudging   `json:"judged_by,omitempty"`
+}
+
+func (round *Round) lastChance() *LastChance {
+	if round.Guesser == (datatypes.UUID{}) {
+		return nil
+	}
+	return &LastChance{
+		Impostor: round.Guesser,
+		Guess:    round.Guess,
+		Judged:   round.GuessJudgedBy != "",
+		Correct:  round.GuessCorrect,
+		JudgedBy: round.GuessJudgedBy,
+	}
+}
+
+// GetLastChance returns the last-chance guess of the current round, or nil if
+// nobody got to guess.
+func (game *Game) GetLastChance(db *gorm.DB) (*LastChance, error) {
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		return nil, err
+	}
+	return round.lastChance(), nil
+}
+
+// GetLastChanceGuesser returns the impostor that gets a last-chance guess, if
+// the game allows it and the vote singled out an impostor.
+func (game *Game) GetLastChanceGuesser(db *gorm.DB) (datatypes.UUID, bool, error) {
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		return datatypes.UUID{}, false, err
+	}
+	if !settings.LastChanceGuess {
+		return datatypes.UUID{}, false, nil
+	}
+
+	outcome, err := game.GetRoundOutcome(db)
+	if err != nil {
+		return datatypes.UUID{}, false, err
+	}
+	if !outcome.Caught() {
+		return datatypes.UUID{}, false, nil
+	}
+
+	return outcome.PluralityTargets()[0], true, nil
+}
+
+// StartGuessing opens the last-chance guess of the caught impostor.
+func (game *Game) StartGuessing(db *gorm.DB, guesser datatypes.UUID, endTime time.Time) error {
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		return err
+	}
+
+	from := game.State
+	game.GuessEndTime = endTime
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(round).Update("guesser", guesser).Error
+		if err != nil {
+			return err
+		}
+
+		return game.transition(tx, GameStateGuessing, "guess_end_time")
+	})
+	if err != nil {
+		return err
+	}
+
+	game.runTransitionHooks(db, from)
+	return nil
+}
+
+// SubmitGuess stores the guess of the caught impostor. Only one guess is
+// allowed.
+func (game *Game) SubmitGuess(db *gorm.DB, userID datatypes.UUID, guess string) (*LastChance, error) {
+	err := game.CanPerform(ActionGuess)
+	if err != nil {
+		return nil, err
+	}
+
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		return nil, err
+	}
+	if round.Guesser != userID {
+		return nil, ErrNotGuesser
+	}
+	if round.Guess != "" {
+		return nil, ErrAlreadyGuessed
+	}
+	if Clock.Now().After(game.GuessEndTime) {
+		return nil, ErrGuessingClosed
+	}
+
+	guess = strings.TrimSpace(guess)
+	if guess == "" {
+		return nil, ErrGuessEmpty
+	}
+	if utf8.RuneCountInString(guess) > MaxGuessLength {
+		return nil, ErrGuessTooLong
+	}
+
+	round.Guess = guess
+	err = db.Model(round).Update("guess", guess).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return round.lastChance(), nil
+}
+
+// JudgeGuess records whether the guess of the current round was right.
+func (game *Game) JudgeGuess(db *gorm.DB, correct bool, judgedBy GuessJudging) (*LastChance, error) {
+	err := game.CanPerform(ActionJudgeGuess)
+	if err != nil {
+		return nil, err
+	}
+
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		return nil, err
+	}
+	if round.Guess == "" {
+		return nil, ErrNoGuess
+	}
+	if round.GuessJudgedBy != "" {
+		return nil, ErrGuessAlreadyJudged
+	}
+
+	round.GuessCorrect = correct
+	round.GuessJudgedBy = judgedBy
+	err = db.Model(round).Updates(map[string]interface{}{
+		"guess_correct":   correct,
+		"guess_judged_by": judgedBy,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return round.lastChance(), nil
+}
+
+// AutoJudgeGuess judges the guess of the current round against the regular
+// question.
+func (game *Game) AutoJudgeGuess(db *gorm.DB) (*LastChance, error) {
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		return nil, err
+	}
+
+	correct := GuessMatches(round.Guess, game.RegularQuestion, game.SneakyQuestion)
+	return game.JudgeGuess(db, correct, GuessJudgingAuto)
+}
+
+// guessStopWords carry no meaning of their own and are ignored when comparing
+// a guess to the questions.
+var guessStopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "but": true,
+	"of": true, "to": true, "in": true, "on": true, "at": true, "for": true,
+	"with": true, "from": true, "about": true, "is": true, "are": true,
+	"was": true, "were": true, "be": true, "been": true, "do": true,
+	"does": true, "did": true, "you": true, "your": true, "youre": true,
+	"youve": true, "youd": true, "yourself": true, "what": true, "whats": true,
+	"which": true, "who": true, "how": true, "when": true, "where": true,
+	"why": true, "would": true, "could": true, "should": true, "can": true,
+	"will": true, "it": true, "its": true, "that": true, "this": true,
+	"there": true, "have": true, "has": true, "had": true, "i": true,
+	"me": true, "my": true, "if": true, "as": true, "so": true, "than": true,
+}
+
+// GuessMatches reports whether a guess names the regular question rather than
+// the sneaky one. The two questions mostly share their words, so a guess is
+// judged by the words that tell them apart: it must not contain any word that
+// only the sneaky question has and must contain one that only the regular
+// question has, if there is one. So a single lucky word is not enough, it must
+// also share at least two words with the regular question. Other words are
+// not held against it, which lets paraphrases through. Case, punctuation and
+// small typos are ignored.
+func GuessMatches(guess string, regularQuestion string, sneakyQuestion string) bool {
+	guessWords := guessContentWords(guess)
+	regularWords := guessContentWords(regularQuestion)
+	if len(guessWords) == 0 || len(regularWords) == 0 {
+		return false
+	}
+	sneakyWords := guessContentWords(sneakyQuestion)
+
+	for _, word := range wordsWithout(sneakyWords, regularWords) {
+		if containsSimilarWord(guessWords, word) {
+			return false
+		}
+	}
+
+	regularOnly := wordsWithout(regularWords, sneakyWords)
+	if len(regularOnly) > 0 && countSimilarWords(guessWords, regularOnly) == 0 {
+		return false
+	}
+
+	return countSimilarWords(guessWords, regularWords) >= min(2, len(regularWords))
+}
+
+func guessContentWords(text string) []string {
+	var words []string
+	for _, word := range strings.Fields(normalizeGuess(text)) {
+		if !guessStopWords[word] {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func normalizeGuess(text string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			builder.WriteRune(r)
+		case unicode.IsSpace(r):
+			builder.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+// wordsWithout returns the words that do not appear in excluded.
+func wordsWithout(words []string, excluded []string) []string {
+	var result []string
+	for _, word := range words {
+		if !slices.Contains(excluded, word) {
+			result = append(result, word)
+		}
+	}
+	return result
+}
+
+func countSimilarWords(words []string, wanted []string) int {
+	count := 0
+	for _, word := range wanted {
+		if containsSimilarWord(words, word) {
+			count++
+		}
+	}
+	return count
+}
+
+// containsSimilarWord reports whether words contains the word or one that
+// only differs by a typo.
+func containsSimilarWord(words []string, word string) bool {
+	for _, candidate := range words {
+		if wordSimilarity(candidate, word) >= GuessSimilarityThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+func wordSimilarity(a string, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// levenshtein returns the number of single rune edits between two strings.
+func levenshtein(a []rune, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
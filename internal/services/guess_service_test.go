@@ -0,0 +1,80 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestGuessMatches(t *testing.T) {
+	const (
+		sleepRegular  = "How many hours of sleep do you need to feel rested?"
+		sleepSneaky   = "How many hours of sleep do you usually get?"
+		pizzaRegular  = "What's your favorite pizza topping?"
+		pizzaSneaky   = "What's a pizza topping you dislike?"
+		travelRegular = "What is your favorite travel destination?"
+		travelSneaky  = "What is your least favorite travel destination?"
+		jobRegular    = "What was your first job?"
+		jobSneaky     = "What was your worst job?"
+	)
+
+	tests := []struct {
+		name    string
+		guess   string
+		regular string
+		sneaky  string
+		want    bool
+	}{
+		{"exact", sleepRegular, sleepRegular, sleepSneaky, true},
+		{"case and punctuation", "HOW MANY HOURS OF SLEEP DO YOU NEED TO FEEL RESTED", sleepRegular, sleepSneaky, true},
+		{"extra whitespace", "  how many   hours of sleep\tdo you need to feel rested ", sleepRegular, sleepSneaky, true},
+		{"typos", "How many hours of slep do you ned to feel restd?", sleepRegular, sleepSneaky, true},
+		{"british spelling", "what's your favourite pizza toping", pizzaRegular, pizzaSneaky, true},
+		{"paraphrase", "how much sleep do you need", sleepRegular, sleepSneaky, true},
+		{"paraphrase with other words", "the first job you ever had", jobRegular, jobSneaky, true},
+		{"paraphrase without the distinguishing word", "favorite destination to travel to", travelRegular, travelSneaky, true},
+		{"sneaky question", sleepSneaky, sleepRegular, sleepSneaky, false},
+		{"sneaky paraphrase", "how much sleep do you get", sleepRegular, sleepSneaky, false},
+		{"negated question", "least favorite travel destination", travelRegular, travelSneaky, false},
+		{"shared words only", "how many hours of sleep", sleepRegular, sleepSneaky, false},
+		{"single lucky word", "what do you need", sleepRegular, sleepSneaky, false},
+		{"other question", "What is your favorite board game?", pizzaRegular, pizzaSneaky, false},
+		{"unrelated", "steak or eggs", "Do you prefer beaches or mountains?", "Do you prefer cities or countryside?", false},
+		{"stop words only", "what is it", pizzaRegular, pizzaSneaky, false},
+		{"empty", "", pizzaRegular, pizzaSneaky, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := GuessMatches(test.guess, test.regular, test.sneaky)
+			if got != test.want {
+				t.Errorf("GuessMatches(%q) = %v, want %v", test.guess, got, test.want)
+			}
+		})
+	}
+}
+
+// Every question of the game must be recognised as itself and never be
+// mistaken for its sneaky counterpart.
+func TestGuessMatchesQuestionPairs(t *testing.T) {
+	data, err := os.ReadFile("../../questions.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var categories Categories
+	err = json.Unmarshal(data, &categories)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, category := range categories.Categories {
+		for _, question := range category.Questions {
+			if !GuessMatches(question.Regular, question.Regular, question.Sneaky) {
+				t.Errorf("%q does not match itself", question.Regular)
+			}
+			if GuessMatches(question.Sneaky, question.Regular, question.Sneaky) {
+				t.Errorf("%q is taken for %q", question.Sneaky, question.Regular)
+			}
+		}
+	}
+}
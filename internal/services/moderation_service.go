@@ -0,0 +1,106 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBanned         = errors.New("user is banned from the game")
+	ErrGameLocked     = errors.New("game is locked")
+	ErrCannotKickHost = errors.New("the host cannot be kicked")
+)
+
+type Ban struct {
+	ID        datatypes.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	GameID    string         `gorm:"index" json:"game_id"`
+	UserID    datatypes.UUID `gorm:"type:uuid;index" json:"user_id"`
+}
+
+// Kick removes a player from the game. They may join again unless banned.
+func (game *Game) Kick(db *gorm.DB, userID datatypes.UUID) error {
+	var member GameMember
+	err := db.Where("game_id = ? AND user_id = ?", game.ID, userID).First(&member).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrNotInGame
+		}
+		return err
+	}
+	if member.Host {
+		return ErrCannotKickHost
+	}
+
+	err = db.Delete(&member).Error
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Ban keeps a user from joining the game again and kicks them if they are
+// still a member, which it reports. Users that already left may be banned
+// too.
+func (game *Game) Ban(db *gorm.DB, userID datatypes.UUID) (bool, error) {
+	kicked := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var member GameMember
+		err := tx.Where("game_id = ? AND user_id = ?", game.ID, userID).First(&member).Error
+		switch {
+		case err == gorm.ErrRecordNotFound:
+			// Not a member (any more), only the ban is stored
+		case err != nil:
+			return err
+		case member.Host:
+			return ErrCannotKickHost
+		default:
+			err = tx.Delete(&member).Error
+			if err != nil {
+				return err
+			}
+			kicked = true
+		}
+
+		banned, err := game.IsBanned(tx, userID)
+		if err != nil || banned {
+			return err
+		}
+		return tx.Create(&Ban{
+			ID:     datatypes.NewUUIDv4(),
+			GameID: game.ID,
+			UserID: userID,
+		}).Error
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return kicked, nil
+}
+
+func (game *Game) IsBanned(db *gorm.DB, userID datatypes.UUID) (bool, error) {
+	var count int64
+	err := db.Model(&Ban{}).Where("game_id = ? AND user_id = ?", game.ID, userID).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// SetLocked opens or closes the game for new players.
+func (game *Game) SetLocked(db *gorm.DB, locked bool) error {
+	game.Locked = locked
+	err := db.Model(game).Update("locked", locked).Error
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
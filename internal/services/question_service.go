@@ -2,6 +2,7 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"math/rand/v2"
 	"os"
@@ -23,6 +24,8 @@ type Question struct {
 
 var categoriesList Categories
 
+var ErrNoQuestions = errors.New("category has no questions")
+
 func InitializeQuestionService() {
 	jsonFile, err := os.Open("questions.json")
 	if err != nil {
@@ -38,22 +41,46 @@ func InitializeQuestionService() {
 }
 
 func selectRandomQuestion() (string, string, error) {
-	randomCategoryIndex := rand.IntN(len(categoriesList.Categories) - 1)
-	randomQuestionIndex := rand.IntN(len(categoriesList.Categories[randomCategoryIndex].Questions) - 1)
+	randomCategoryIndex := rand.IntN(len(categoriesList.Categories))
+	randomQuestionIndex := rand.IntN(len(categoriesList.Categories[randomCategoryIndex].Questions))
 	randomCategory := categoriesList.Categories[randomCategoryIndex]
 	randomQuestion := randomCategory.Questions[randomQuestionIndex]
 	return randomQuestion.Regular, randomQuestion.Sneaky, nil
 }
 
-func SelectQuestionFromCategory(categoryName string) (string, string, error) {
+// SelectQuestionFromCategory picks a question the game has asked the fewest
+// times, given the regular questions of its rounds so far. Every question of
+// the category comes up once before any is asked again.
+func SelectQuestionFromCategory(categoryName string, used []string) (string, string, error) {
 	for _, category := range categoriesList.Categories {
-		if category.Name == categoryName {
-			randomQuestionIndex := rand.IntN(len(category.Questions) - 1)
-			randomQuestion := category.Questions[randomQuestionIndex]
-			return randomQuestion.Regular, randomQuestion.Sneaky, nil
+		if category.Name != categoryName {
+			continue
 		}
+		if len(category.Questions) == 0 {
+			return "", "", ErrNoQuestions
+		}
+
+		uses := make(map[string]int, len(used))
+		for _, question := range used {
+			uses[question]++
+		}
+		var candidates []Question
+		fewest := -1
+		for _, question := range category.Questions {
+			count := uses[question.Regular]
+			if fewest == -1 || count < fewest {
+				candidates = candidates[:0]
+				fewest = count
+			}
+			if count == fewest {
+				candidates = append(candidates, question)
+			}
+		}
+
+		randomQuestion := candidates[rand.IntN(len(candidates))]
+		return randomQuestion.Regular, randomQuestion.Sneaky, nil
 	}
-	return "", "", nil
+	return "", "", ErrNoQuestions
 }
 
 func GetAvailableCategories() ([]string, error) {
@@ -63,3 +90,12 @@ func GetAvailableCategories() ([]string, error) {
 	}
 	return categories, nil
 }
+
+func categoryExists(categoryName string) bool {
+	for _, category := range categoriesList.Categories {
+		if category.Name == categoryName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type TieBreak string
+
+const (
+	TieBreakNone    TieBreak = "none"     // One player received the most votes
+	TieBreakTied    TieBreak = "tied"     // Several players share the most votes, nobody is accused
+	TieBreakNoVotes TieBreak = "no_votes" // Nobody voted, nobody is accused
+)
+
+type Verdict string
+
+const (
+	VerdictCaught  Verdict = "caught"
+	VerdictEscaped Verdict = "escaped"
+)
+
+// RoundResult is the public summary of a finished round.
+type RoundResult struct {
+	Round           int               `json:"round"`
+	Impostors       []datatypes.UUID  `json:"impostors"`
+	RegularQuestion string            `json:"regular_question"`
+	SneakyQuestion  string            `json:"sneaky_question"`
+	Votes           map[string]string `json:"votes"`
+	Tally           map[string]int    `json:"tally"`
+	Accused         []datatypes.UUID  `json:"accused"`
+	TieBreak        TieBreak          `json:"tie_break"`
+	Verdict         Verdict           `json:"verdict"`
+	Winner          Side              `json:"winner"`
+	ScoreDeltas     map[string]int    `json:"score_deltas"`
+	AudienceVerdict *AudienceVerdict  `json:"audience_verdict,omitempty"` // Only set if the audience voted
+	LastChance      *LastChance       `json:"last_chance,omitempty"`      // Only set if a caught impostor got to guess
+}
+
+// Tally returns the number of votes each target received.
+func (outcome *RoundOutcome) Tally() map[datatypes.UUID]int {
+	tally := make(map[datatypes.UUID]int)
+	for _, target := range outcome.Votes {
+		tally[target]++
+	}
+	return tally
+}
+
+func (outcome *RoundOutcome) TieBreak() TieBreak {
+	switch targets := outcome.PluralityTargets(); {
+	case len(targets) == 0:
+		return TieBreakNoVotes
+	case len(targets) > 1:
+		return TieBreakTied
+	default:
+		return TieBreakNone
+	}
+}
+
+func (outcome *RoundOutcome) Verdict() Verdict {
+	if outcome.Caught() {
+		return VerdictCaught
+	}
+	return VerdictEscaped
+}
+
+func (game *Game) GetRoundOutcome(db *gorm.DB) (*RoundOutcome, error) {
+	votes, err := game.GetVoteResults(db)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := game.GetPlayers(db)
+	if err != nil {
+		return nil, err
+	}
+
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRoundOutcome(members, votes, round), nil
+}
+
+// GetRoundResult builds the results of the current round without touching
+// the members' scores, so it can be resent to clients that reconnect.
+func (game *Game) GetRoundResult(db *gorm.DB) (*RoundResult, error) {
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := GetScoringRules(settings.ScoringMode)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome, err := game.GetRoundOutcome(db)
+	if err != nil {
+		return nil, err
+	}
+
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newRoundResult(round, outcome, rules.Score(outcome))
+	result.AudienceVerdict, err = getAudienceVerdict(db, round, outcome.Impostors)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func newRoundResult(round *Round, outcome *RoundOutcome, score *ScoreResult) *RoundResult {
+	impostors := make([]datatypes.UUID, 0, len(outcome.Impostors))
+	for impostor := range outcome.Impostors {
+		impostors = append(impostors, impostor)
+	}
+
+	votes := make(map[string]string, len(outcome.Votes))
+	for voter, target := range outcome.Votes {
+		votes[voter.String()] = target.String()
+	}
+
+	tally := make(map[string]int)
+	for target, count := range outcome.Tally() {
+		tally[target.String()] = count
+	}
+
+	accused := []datatypes.UUID{}
+	if targets := outcome.PluralityTargets(); len(targets) == 1 {
+		accused = targets
+	}
+
+	deltas := make(map[string]int, len(score.Deltas))
+	for userID, delta := range score.Deltas {
+		deltas[userID.String()] = delta
+	}
+
+	return &RoundResult{
+		Round:           round.Number,
+		Impostors:       impostors,
+		RegularQuestion: round.RegularQuestion,
+		SneakyQuestion:  round.SneakyQuestion,
+		Votes:           votes,
+		Tally:           tally,
+		Accused:         accused,
+		TieBreak:        outcome.TieBreak(),
+		Verdict:         outcome.Verdict(),
+		Winner:          score.Winner,
+		ScoreDeltas:     deltas,
+		LastChance:      round.lastChance(),
+	}
+}
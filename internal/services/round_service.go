@@ -0,0 +1,234 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type Round struct {
+	ID              datatypes.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	GameID          string         `gorm:"index" json:"game_id"`
+	Number          int            `gorm:"index" json:"number"`
+	RegularQuestion string         `json:"regular_question"`
+	SneakyQuestion  string         `json:"sneaky_question"`
+	Archived        bool           `gorm:"index" json:"archived"`
+	Guesser         datatypes.UUID `gorm:"type:uuid" json:"guesser"` // Caught impostor with a last-chance guess
+	Guess           string         `json:"guess"`
+	GuessCorrect    bool           `json:"guess_correct"`
+	GuessJudgedBy   GuessJudging   `json:"guess_judged_by"` // Empty until the guess was judged
+	Answers         []Answer       `gorm:"foreignKey:RoundID;constraint:OnDelete:CASCADE" json:"answers"`
+	Votes           []Vote         `gorm:"foreignKey:RoundID;constraint:OnDelete:CASCADE" json:"votes"`
+}
+
+type Vote struct {
+	ID        datatypes.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	GameID    string         `gorm:"index" json:"game_id"`
+	RoundID   datatypes.UUID `gorm:"type:uuid;index" json:"round_id"`
+	UserID    datatypes.UUID `gorm:"type:uuid;index" json:"user_id"`
+	TargetID  datatypes.UUID `gorm:"type:uuid;index" json:"target_id"`
+}
+
+type Standing struct {
+	UserID datatypes.UUID `json:"user_id"`
+	Score  int            `json:"score"`
+}
+
+// StartRound advances the game to its next round with a fresh question and
+// fresh impostors, clearing the flags left over from the previous round, and
+// opens the answering phase until answersEnd. Absent players are not picked
+// as impostors. The round is set up in one transaction and the phase only
+// opens once it is complete, so a failed start leaves the game where it was.
+func (game *Game) StartRound(db *gorm.DB, settings *GameSettings, answersEnd time.Time, absent []datatypes.UUID) (*Round, []GameMember, error) {
+	err := game.CanPerform(ActionStart)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if game.CurrentRound >= settings.RoundCount {
+		return nil, nil, ErrNoRoundsLeft
+	}
+
+	// Rounds of earlier matches count too, so a rematch gets new questions
+	var used []string
+	err = db.Model(&Round{}).Where("game_id = ?", game.ID).Pluck("regular_question", &used).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	regularQuestion, sneakyQuestion, err := SelectQuestionFromCategory(settings.Category, used)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	previous := *game
+	from := game.State
+	var roundObj *Round
+	var impostors []GameMember
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Spectators that joined during the last round play from now on
+		err := game.PromoteSpectators(tx)
+		if err != nil {
+			return err
+		}
+
+		members, err := game.GetPlayers(tx)
+		if err != nil {
+			return err
+		}
+
+		err = settings.ValidatePlayerCount(len(withoutAbsent(members, absent)))
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&GameMember{}).Where("game_id = ?", game.ID).
+			Updates(map[string]interface{}{"impostor": false, "vote": datatypes.UUID{}}).Error
+		if err != nil {
+			return err
+		}
+
+		roundObj = &Round{
+			ID:              datatypes.NewUUIDv4(),
+			GameID:          game.ID,
+			Number:          game.CurrentRound + 1,
+			RegularQuestion: regularQuestion,
+			SneakyQuestion:  sneakyQuestion,
+		}
+		err = tx.Create(roundObj).Error
+		if err != nil {
+			return err
+		}
+
+		impostors, err = game.SelectImpostors(tx, settings.ImpostorCount, absent)
+		if err != nil {
+			return err
+		}
+
+		game.CurrentRound = roundObj.Number
+		game.RegularQuestion = regularQuestion
+		game.SneakyQuestion = sneakyQuestion
+		game.AnswersEndTime = answersEnd
+		return game.transition(tx, GameStateAnswering, "current_round", "regular_question", "sneaky_question", "answers_end_time")
+	})
+	if err != nil {
+		*game = previous
+		return nil, nil, err
+	}
+
+	game.runTransitionHooks(db, from)
+	return roundObj, impostors, nil
+}
+
+func (game *Game) GetCurrentRound(db *gorm.DB) (*Round, error) {
+	var roundObj Round
+	err := db.Where("game_id = ? AND number = ? AND archived = ?", game.ID, game.CurrentRound, false).First(&roundObj).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &roundObj, nil
+}
+
+// FinishRound ends the voting phase, moving the game to the round end state
+// or, after the last round, to the finished state. The round is scored in the
+// same transaction, so the host cannot start the next round and reset the
+// impostors before they are scored. It returns the results.
+func (game *Game) FinishRound(db *gorm.DB) (*RoundResult, error) {
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		return nil, err
+	}
+
+	next := GameStateRoundEnd
+	if game.CurrentRound >= settings.RoundCount {
+		next = GameStateFinished
+	}
+
+	from := game.State
+	var result *RoundResult
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := game.transition(tx, next)
+		if err != nil {
+			return err
+		}
+
+		result, err = game.scoreRound(tx, settings)
+		return err
+	})
+	if err != nil {
+		game.State = from
+		return nil, err
+	}
+
+	game.runTransitionHooks(db, from)
+	return result, nil
+}
+
+// scoreRound scores the current round with the game's rule set, adds the
+// resulting deltas to every member's running score and returns the results.
+func (game *Game) scoreRound(db *gorm.DB, settings *GameSettings) (*RoundResult, error) {
+	rules, err := GetScoringRules(settings.ScoringMode)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome, err := game.GetRoundOutcome(db)
+	if err != nil {
+		return nil, err
+	}
+
+	round, err := game.GetCurrentRound(db)
+	if err != nil {
+		return nil, err
+	}
+
+	score := rules.Score(outcome)
+
+	for i := range outcome.Members {
+		member := &outcome.Members[i]
+		delta := score.Deltas[member.UserID]
+		if delta == 0 {
+			continue
+		}
+		member.Score += delta
+		err = db.Model(member).Update("score", member.Score).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := newRoundResult(round, outcome, score)
+	result.AudienceVerdict, err = getAudienceVerdict(db, round, outcome.Impostors)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (game *Game) GetStandings(db *gorm.DB) ([]Standing, error) {
+	members, err := game.GetMembers(db)
+	if err != nil {
+		return nil, err
+	}
+
+	standings := make([]Standing, 0, len(members))
+	for _, member := range members {
+		standings = append(standings, Standing{
+			UserID: member.UserID,
+			Score:  member.Score,
+		})
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		return standings[i].Score > standings[j].Score
+	})
+
+	return standings, nil
+}
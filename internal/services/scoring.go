@@ -0,0 +1,187 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"gorm.io/datatypes"
+)
+
+type Side string
+
+const (
+	SideCrewmates Side = "crewmates"
+	SideImpostors Side = "impostors"
+)
+
+const DefaultScoringMode = "classic"
+
+// RoundOutcome is everything a rule set needs to know to score a round.
+type RoundOutcome struct {
+	Members   []GameMember
+	Impostors map[datatypes.UUID]bool
+	Votes     map[datatypes.UUID]datatypes.UUID // voter -> target
+	Guesser   datatypes.UUID                    // Caught impostor that guessed the real question right
+}
+
+type ScoreResult struct {
+	Deltas map[datatypes.UUID]int
+	Winner Side
+}
+
+type ScoringRules interface {
+	Name() string
+	Score(outcome *RoundOutcome) *ScoreResult
+}
+
+var scoringRules = map[string]ScoringRules{}
+
+func init() {
+	RegisterScoringRules(classicRules{})
+	RegisterScoringRules(survivorRules{})
+}
+
+func RegisterScoringRules(rules ScoringRules) {
+	scoringRules[rules.Name()] = rules
+}
+
+func GetScoringRules(name string) (ScoringRules, error) {
+	rules, ok := scoringRules[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scoring mode")
+	}
+	return rules, nil
+}
+
+func GetAvailableScoringModes() []string {
+	modes := make([]string, 0, len(scoringRules))
+	for name := range scoringRules {
+		modes = append(modes, name)
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+func newRoundOutcome(members []GameMember, votes map[datatypes.UUID]datatypes.UUID, round *Round) *RoundOutcome {
+	impostors := make(map[datatypes.UUID]bool)
+	for _, member := range members {
+		if member.Impostor {
+			impostors[member.UserID] = true
+		}
+	}
+
+	outcome := &RoundOutcome{
+		Members:   members,
+		Impostors: impostors,
+		Votes:     votes,
+	}
+	if round.GuessCorrect {
+		outcome.Guesser = round.Guesser
+	}
+	return outcome
+}
+
+// PluralityTargets returns the users that received the most votes. More than
+// one entry means the vote was tied.
+func (outcome *RoundOutcome) PluralityTargets() []datatypes.UUID {
+	return pluralityTargets(outcome.Tally())
+}
+
+func pluralityTargets(tally map[datatypes.UUID]int) []datatypes.UUID {
+	highest := 0
+	for _, count := range tally {
+		if count > highest {
+			highest = count
+		}
+	}
+
+	var targets []datatypes.UUID
+	for target, count := range tally {
+		if count == highest {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// Caught reports whether the group singled out an impostor.
+func (outcome *RoundOutcome) Caught() bool {
+	targets := outcome.PluralityTargets()
+	return len(targets) == 1 && outcome.Impostors[targets[0]]
+}
+
+// GuessedRight reports whether the caught impostor made up for it by guessing
+// the real question.
+func (outcome *RoundOutcome) GuessedRight() bool {
+	return outcome.Guesser != (datatypes.UUID{})
+}
+
+func (outcome *RoundOutcome) winner() Side {
+	if outcome.Caught() && !outcome.GuessedRight() {
+		return SideCrewmates
+	}
+	return SideImpostors
+}
+
+// classicRules gives crewmates a point for voting an impostor and impostors a
+// point for every crewmate vote that missed them. A caught impostor that
+// guesses the real question gets a bonus on top.
+type classicRules struct{}
+
+const lastChanceBonus = 2
+
+func (classicRules) Name() string { return "classic" }
+
+func (classicRules) Score(outcome *RoundOutcome) *ScoreResult {
+	deltas := make(map[datatypes.UUID]int)
+	for voter, target := range outcome.Votes {
+		if outcome.Impostors[voter] {
+			continue
+		}
+		if outcome.Impostors[target] {
+			deltas[voter]++
+			continue
+		}
+		for impostor := range outcome.Impostors {
+			deltas[impostor]++
+		}
+	}
+	if outcome.GuessedRight() {
+		deltas[outcome.Guesser] += lastChanceBonus
+	}
+
+	return &ScoreResult{
+		Deltas: deltas,
+		Winner: outcome.winner(),
+	}
+}
+
+// survivorRules gives crewmates a point for voting an impostor and impostors a
+// large bonus when the plurality misses them or the caught impostor guesses
+// the real question.
+type survivorRules struct{}
+
+const survivorBonus = 5
+
+func (survivorRules) Name() string { return "survivor" }
+
+func (survivorRules) Score(outcome *RoundOutcome) *ScoreResult {
+	deltas := make(map[datatypes.UUID]int)
+	for voter, target := range outcome.Votes {
+		if !outcome.Impostors[voter] && outcome.Impostors[target] {
+			deltas[voter]++
+		}
+	}
+
+	winner := outcome.winner()
+	if winner == SideImpostors {
+		for impostor := range outcome.Impostors {
+			deltas[impostor] += survivorBonus
+		}
+	}
+
+	return &ScoreResult{
+		Deltas: deltas,
+		Winner: winner,
+	}
+}
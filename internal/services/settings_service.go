@@ -0,0 +1,278 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultImpostorCount     = 1
+	DefaultAnswerSeconds     = 60
+	DefaultVotingSeconds     = 30
+	DefaultRoundCount        = 1
+	DefaultDiscussionSeconds = 0 // No discussion phase
+
+	MinPhaseSeconds = 10
+	MaxPhaseSeconds = 600
+	MaxRoundCount   = 20
+)
+
+type GameSettings struct {
+	GameID            string       `gorm:"primaryKey" json:"game_id"`
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+	ImpostorCount     int          `gorm:"default:1" json:"impostor_count"`
+	AnswerSeconds     int          `gorm:"default:60" json:"answer_seconds"`
+	VotingSeconds     int          `gorm:"default:30" json:"voting_seconds"`
+	Category          string       `json:"category"`
+	RoundCount        int          `gorm:"default:1" json:"round_count"`
+	ScoringMode       string       `gorm:"default:'classic'" json:"scoring_mode"`
+	EarlyCompletion   bool         `gorm:"default:true" json:"early_completion"`  // End a phase as soon as every player acted
+	DiscussionSeconds int          `gorm:"default:0" json:"discussion_seconds"`   // 0 goes straight from answering to voting
+	SpectatorChat     bool         `gorm:"default:false" json:"spectator_chat"`   // Let spectators chat while a round is running
+	LastChanceGuess   bool         `gorm:"default:true" json:"last_chance_guess"` // A caught impostor may still win by guessing the real question
+	GuessSeconds      int          `gorm:"default:30" json:"guess_seconds"`
+	GuessJudging      GuessJudging `gorm:"default:'auto'" json:"guess_judging"`
+}
+
+// SettingsUpdate holds a partial change to a game's settings. Nil fields are
+// left untouched.
+type SettingsUpdate struct {
+	ImpostorCount     *int          `json:"impostor_count"`
+	AnswerSeconds     *int          `json:"answer_seconds"`
+	VotingSeconds     *int          `json:"voting_seconds"`
+	Category          *string       `json:"category"`
+	RoundCount        *int          `json:"round_count"`
+	ScoringMode       *string       `json:"scoring_mode"`
+	EarlyCompletion   *bool         `json:"early_completion"`
+	DiscussionSeconds *int          `json:"discussion_seconds"`
+	SpectatorChat     *bool         `json:"spectator_chat"`
+	LastChanceGuess   *bool         `json:"last_chance_guess"`
+	GuessSeconds      *int          `json:"guess_seconds"`
+	GuessJudging      *GuessJudging `json:"guess_judging"`
+}
+
+// SettingsError is returned when settings fail validation.
+type SettingsError struct {
+	message string
+}
+
+func (err *SettingsError) Error() string {
+	return err.message
+}
+
+func settingsErrorf(format string, args ...interface{}) error {
+	return &SettingsError{message: fmt.Sprintf(format, args...)}
+}
+
+// newGameSettings returns the default settings of a game with the choices
+// made when creating it.
+func newGameSettings(category string, rounds int, scoringMode string) *GameSettings {
+	return &GameSettings{
+		ImpostorCount:     DefaultImpostorCount,
+		AnswerSeconds:     DefaultAnswerSeconds,
+		VotingSeconds:     DefaultVotingSeconds,
+		Category:          category,
+		RoundCount:        rounds,
+		ScoringMode:       scoringMode,
+		EarlyCompletion:   true,
+		DiscussionSeconds: DefaultDiscussionSeconds,
+		LastChanceGuess:   true,
+		GuessSeconds:      DefaultGuessSeconds,
+		GuessJudging:      GuessJudgingAuto,
+	}
+}
+
+// legacySettingsColumns held the settings on the games table before they got
+// a table of their own.
+var legacySettingsColumns = []string{"category", "round_count", "scoring_mode"}
+
+// MigrateLegacySettings creates the settings of the games from before
+// settings had a table of their own, keeping the category, round count and
+// scoring mode they were created with, and then drops the old columns. It
+// does nothing once they are gone.
+func MigrateLegacySettings(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Game{}, "category") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		columns := []string{"id"}
+		for _, column := range legacySettingsColumns {
+			if tx.Migrator().HasColumn(&Game{}, column) {
+				columns = append(columns, column)
+			}
+		}
+
+		var games []struct {
+			ID          string
+			Category    string
+			RoundCount  int
+			ScoringMode string
+		}
+		err := tx.Table("games").Select(columns).
+			Where("id NOT IN (?)", tx.Model(&GameSettings{}).Select("game_id")).
+			Scan(&games).Error
+		if err != nil {
+			return err
+		}
+
+		for _, game := range games {
+			if game.RoundCount == 0 {
+				game.RoundCount = DefaultRoundCount
+			}
+			if game.ScoringMode == "" {
+				game.ScoringMode = DefaultScoringMode
+			}
+			settings := newGameSettings(game.Category, game.RoundCount, game.ScoringMode)
+			settings.GameID = game.ID
+			err = tx.Create(settings).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if tx.Migrator().HasIndex(&Game{}, "idx_games_category") {
+			err = tx.Migrator().DropIndex(&Game{}, "idx_games_category")
+			if err != nil {
+				return err
+			}
+		}
+		for _, column := range columns[1:] {
+			err = tx.Migrator().DropColumn(&Game{}, column)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (game *Game) GetSettings(db *gorm.DB) (*GameSettings, error) {
+	var settings GameSettings
+	err := db.First(&settings, "game_id = ?", game.ID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+func (settings *GameSettings) Validate() error {
+	if settings.ImpostorCount < 1 {
+		return settingsErrorf("impostor count must be at least 1")
+	}
+	if settings.AnswerSeconds < MinPhaseSeconds || settings.AnswerSeconds > MaxPhaseSeconds {
+		return settingsErrorf("answer seconds must be between %d and %d", MinPhaseSeconds, MaxPhaseSeconds)
+	}
+	if settings.VotingSeconds < MinPhaseSeconds || settings.VotingSeconds > MaxPhaseSeconds {
+		return settingsErrorf("voting seconds must be between %d and %d", MinPhaseSeconds, MaxPhaseSeconds)
+	}
+	if settings.DiscussionSeconds != 0 && (settings.DiscussionSeconds < MinPhaseSeconds || settings.DiscussionSeconds > MaxPhaseSeconds) {
+		return settingsErrorf("discussion seconds must be 0 or between %d and %d", MinPhaseSeconds, MaxPhaseSeconds)
+	}
+	if settings.GuessSeconds < MinPhaseSeconds || settings.GuessSeconds > MaxPhaseSeconds {
+		return settingsErrorf("guess seconds must be between %d and %d", MinPhaseSeconds, MaxPhaseSeconds)
+	}
+	if settings.GuessJudging != GuessJudgingAuto && settings.GuessJudging != GuessJudgingHost {
+		return settingsErrorf("guess judging must be %s or %s", GuessJudgingAuto, GuessJudgingHost)
+	}
+	if settings.RoundCount < 1 || settings.RoundCount > MaxRoundCount {
+		return settingsErrorf("round count must be between 1 and %d", MaxRoundCount)
+	}
+	if !categoryExists(settings.Category) {
+		return settingsErrorf("unknown category")
+	}
+	if _, err := GetScoringRules(settings.ScoringMode); err != nil {
+		return settingsErrorf("unknown scoring mode")
+	}
+
+	return nil
+}
+
+// ValidatePlayerCount checks that the impostors leave at least one crewmate.
+func (settings *GameSettings) ValidatePlayerCount(playerCount int) error {
+	if settings.ImpostorCount >= playerCount {
+		return settingsErrorf("impostor count must be lower than the number of players")
+	}
+
+	return nil
+}
+
+// UpdateSettings applies a partial update to the game's settings.
+func (game *Game) UpdateSettings(db *gorm.DB, update SettingsUpdate) (*GameSettings, error) {
+	err := game.CanPerform(ActionUpdateSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.ImpostorCount != nil {
+		settings.ImpostorCount = *update.ImpostorCount
+	}
+	if update.AnswerSeconds != nil {
+		settings.AnswerSeconds = *update.AnswerSeconds
+	}
+	if update.VotingSeconds != nil {
+		settings.VotingSeconds = *update.VotingSeconds
+	}
+	if update.Category != nil {
+		settings.Category = *update.Category
+	}
+	if update.RoundCount != nil {
+		settings.RoundCount = *update.RoundCount
+	}
+	if update.ScoringMode != nil {
+		settings.ScoringMode = *update.ScoringMode
+	}
+	if update.EarlyCompletion != nil {
+		settings.EarlyCompletion = *update.EarlyCompletion
+	}
+	if update.DiscussionSeconds != nil {
+		settings.DiscussionSeconds = *update.DiscussionSeconds
+	}
+	if update.SpectatorChat != nil {
+		settings.SpectatorChat = *update.SpectatorChat
+	}
+	if update.LastChanceGuess != nil {
+		settings.LastChanceGuess = *update.LastChanceGuess
+	}
+	if update.GuessSeconds != nil {
+		settings.GuessSeconds = *update.GuessSeconds
+	}
+	if update.GuessJudging != nil {
+		settings.GuessJudging = *update.GuessJudging
+	}
+
+	err = settings.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	// Players may still join, so only hold the impostor count itself against
+	// the current lobby size. It is checked again when a round starts.
+	if update.ImpostorCount != nil {
+		members, err := game.GetPlayers(db)
+		if err != nil {
+			return nil, err
+		}
+
+		err = settings.ValidatePlayerCount(len(members))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = db.Save(settings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMigrateLegacySettings(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would get a database of its own
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	// The games table as it was when it still held the settings
+	err = db.Exec("CREATE TABLE `games` (`id` text,`created_at` datetime,`updated_at` datetime," +
+		"`category` text,`regular_question` text,`sneaky_question` text,`answers_end_time` datetime," +
+		"`voting_end_time` datetime,`state` text DEFAULT 'lobby',`round_count` integer DEFAULT 1," +
+		"`scoring_mode` text DEFAULT 'classic',`current_round` integer,PRIMARY KEY (`id`))").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Exec("CREATE INDEX `idx_games_category` ON `games`(`category`)").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Exec(`INSERT INTO games (id, category, state, round_count, scoring_mode) VALUES
+		('ABCD', 'Food', 'round_end', 3, 'survivor'), ('EFGH', 'Travel', 'lobby', 0, '')`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.AutoMigrate(&Game{}, &GameSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = MigrateLegacySettings(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		gameID      string
+		category    string
+		roundCount  int
+		scoringMode string
+	}{
+		{"ABCD", "Food", 3, "survivor"},
+		{"EFGH", "Travel", DefaultRoundCount, DefaultScoringMode},
+	}
+	for _, test := range tests {
+		game, err := GetGameByID(db, test.gameID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		settings, err := game.GetSettings(db)
+		if err != nil {
+			t.Fatalf("settings of game %s: %v", test.gameID, err)
+		}
+		if settings.Category != test.category || settings.RoundCount != test.roundCount || settings.ScoringMode != test.scoringMode {
+			t.Errorf("settings of game %s are %+v, want category %q, %d rounds and scoring mode %q", test.gameID, settings, test.category, test.roundCount, test.scoringMode)
+		}
+		if settings.AnswerSeconds != DefaultAnswerSeconds {
+			t.Errorf("game %s answers for %d seconds, want the default %d", test.gameID, settings.AnswerSeconds, DefaultAnswerSeconds)
+		}
+	}
+
+	for _, column := range legacySettingsColumns {
+		if db.Migrator().HasColumn(&Game{}, column) {
+			t.Errorf("column %s was not dropped", column)
+		}
+	}
+
+	// Running again leaves the migrated games alone
+	err = MigrateLegacySettings(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Action is something a player asks the game to do.
+type Action string
+
+const (
+	ActionStart          Action = "start"
+	ActionAnswer         Action = "answer"
+	ActionVote           Action = "vote"
+	ActionUpdateSettings Action = "update_settings"
+	ActionRematch        Action = "rematch"
+	ActionChat           Action = "chat"
+	ActionGuess          Action = "guess"
+	ActionJudgeGuess     Action = "judge_guess"
+)
+
+// transitions lists the states each state may move to.
+var transitions = map[GameState][]GameState{
+	GameStateLobby:      {GameStateAnswering},
+	GameStateAnswering:  {GameStateDiscussion, GameStateVoting},
+	GameStateDiscussion: {GameStateVoting},
+	GameStateVoting:     {GameStateGuessing, GameStateRoundEnd, GameStateFinished},
+	GameStateGuessing:   {GameStateRoundEnd, GameStateFinished},
+	GameStateRoundEnd:   {GameStateAnswering},
+	GameStateFinished:   {GameStateLobby},
+}
+
+// allowedActions lists the actions players may take in each state.
+var allowedActions = map[GameState][]Action{
+	GameStateLobby:      {ActionStart, ActionUpdateSettings, ActionChat},
+	GameStateAnswering:  {ActionAnswer, ActionChat},
+	GameStateDiscussion: {ActionChat},
+	GameStateVoting:     {ActionVote, ActionChat},
+	GameStateGuessing:   {ActionGuess, ActionJudgeGuess, ActionChat},
+	GameStateRoundEnd:   {ActionStart, ActionChat},
+	GameStateFinished:   {ActionRematch, ActionChat},
+}
+
+// StateHook runs after a game entered or left a state.
+type StateHook func(db *gorm.DB, game *Game)
+
+var enterHooks = map[GameState][]StateHook{}
+var exitHooks = map[GameState][]StateHook{}
+
+func OnEnterState(state GameState, hook StateHook) {
+	enterHooks[state] = append(enterHooks[state], hook)
+}
+
+func OnExitState(state GameState, hook StateHook) {
+	exitHooks[state] = append(exitHooks[state], hook)
+}
+
+// TransitionError is returned when a game cannot move between two states,
+// either because the transition is not declared or because the game already
+// left the state it was expected to be in.
+type TransitionError struct {
+	From GameState
+	To   GameState
+}
+
+func (err *TransitionError) Error() string {
+	return fmt.Sprintf("cannot move game from %s to %s", err.From, err.To)
+}
+
+// ActionError is returned when an action is not allowed in the current state.
+type ActionError struct {
+	State  GameState
+	Action Action
+}
+
+func (err *ActionError) Error() string {
+	return fmt.Sprintf("%s is not allowed while the game is in state %s", err.Action, err.State)
+}
+
+func (state GameState) CanTransitionTo(next GameState) bool {
+	for _, allowed := range transitions[state] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+func (game *Game) CanPerform(action Action) error {
+	for _, allowed := range allowedActions[game.State] {
+		if allowed == action {
+			return nil
+		}
+	}
+	return &ActionError{State: game.State, Action: action}
+}
+
+// TransitionTo moves the game to the next state and saves it along with the
+// given columns, e.g. the deadline of the next phase. Nothing else is written
+// so concurrent updates of other columns are kept. The state change only
+// applies if the stored game is still in the state this copy was loaded in,
+// so concurrent transitions cannot both succeed.
+func (game *Game) TransitionTo(db *gorm.DB, next GameState, columns ...string) error {
+	from := game.State
+	err := game.transition(db, next, columns...)
+	if err != nil {
+		return err
+	}
+
+	game.runTransitionHooks(db, from)
+	return nil
+}
+
+// transition saves the state change without running the hooks, so it can be
+// part of a larger transaction. The hooks run once it is committed.
+func (game *Game) transition(tx *gorm.DB, next GameState, columns ...string) error {
+	from := game.State
+	if !from.CanTransitionTo(next) {
+		return &TransitionError{From: from, To: next}
+	}
+
+	game.State = next
+	result := tx.Model(game).Where("state = ?", from).
+		Select(append([]string{"state"}, columns...)).Updates(game)
+	if result.Error != nil {
+		game.State = from
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		game.State = from
+		return &TransitionError{From: from, To: next}
+	}
+
+	return nil
+}
+
+func (game *Game) runTransitionHooks(db *gorm.DB, from GameState) {
+	for _, hook := range exitHooks[from] {
+		hook(db, game)
+	}
+	for _, hook := range enterHooks[game.State] {
+		hook(db, game)
+	}
+}
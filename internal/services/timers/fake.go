@@ -0,0 +1,64 @@
+package timers
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock only moves when it is advanced. Timers count from the time last
+// handed out, which is the time a scheduler computed the delay from, even if
+// the clock was advanced in between.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	read    time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, read: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.read = c.now
+	return c.now
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	deadline := c.read.Add(d)
+	if deadline.After(c.now) {
+		c.waiters = append(c.waiters, waiter{deadline: deadline, ch: ch})
+	} else {
+		ch <- c.now
+	}
+	return ch
+}
+
+// Advance moves the clock forward and fires the timers that are due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
@@ -0,0 +1,154 @@
+package timers
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// Clock abstracts time so the scheduler can be driven by a fake clock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type entry struct {
+	key      string
+	deadline time.Time
+	fn       func()
+	index    int
+}
+
+// entryHeap is a min-heap of entries ordered by deadline.
+type entryHeap []*entry
+
+func (h entryHeap) Len() int           { return len(h) }
+func (h entryHeap) Less(i, j int) bool { return h[i].deadline.Before(h[j].deadline) }
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
+
+// Scheduler keeps at most one pending deadline per key and runs its callback
+// once the deadline has passed. Callbacks run on their own goroutine so a slow
+// transition never delays other keys.
+type Scheduler struct {
+	clock   Clock
+	mu      sync.Mutex
+	entries entryHeap
+	byKey   map[string]*entry
+	wake    chan struct{}
+	stop    chan struct{}
+}
+
+func NewScheduler(clock Clock) *Scheduler {
+	scheduler := &Scheduler{
+		clock: clock,
+		byKey: make(map[string]*entry),
+		wake:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+	}
+	go scheduler.run()
+	return scheduler
+}
+
+// Schedule runs fn at deadline, replacing any deadline pending for key.
+// Deadlines in the past fire immediately.
+func (s *Scheduler) Schedule(key string, deadline time.Time, fn func()) {
+	s.mu.Lock()
+	if existing, ok := s.byKey[key]; ok {
+		heap.Remove(&s.entries, existing.index)
+	}
+	e := &entry{key: key, deadline: deadline, fn: fn}
+	heap.Push(&s.entries, e)
+	s.byKey[key] = e
+	s.mu.Unlock()
+
+	s.notify()
+}
+
+// Cancel drops the deadline pending for key, if any.
+func (s *Scheduler) Cancel(key string) {
+	s.mu.Lock()
+	if existing, ok := s.byKey[key]; ok {
+		heap.Remove(&s.entries, existing.index)
+		delete(s.byKey, key)
+	}
+	s.mu.Unlock()
+
+	s.notify()
+}
+
+// Pending returns the deadline scheduled for key.
+func (s *Scheduler) Pending(key string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.byKey[key]; ok {
+		return existing.deadline, true
+	}
+	return time.Time{}, false
+}
+
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) run() {
+	for {
+		var timer <-chan time.Time
+
+		s.mu.Lock()
+		now := s.clock.Now()
+		for len(s.entries) > 0 && !s.entries[0].deadline.After(now) {
+			e := heap.Pop(&s.entries).(*entry)
+			delete(s.byKey, e.key)
+			go e.fn()
+		}
+		if len(s.entries) > 0 {
+			timer = s.clock.After(s.entries[0].deadline.Sub(now))
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-timer:
+		case <-s.wake:
+		case <-s.stop:
+			return
+		}
+	}
+}
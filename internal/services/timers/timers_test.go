@@ -0,0 +1,104 @@
+package timers
+
+import (
+	"testing"
+	"time"
+)
+
+func newFakeClock() *FakeClock {
+	return NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+func expectFired(t *testing.T, fired <-chan string, want string) {
+	t.Helper()
+
+	select {
+	case got := <-fired:
+		if got != want {
+			t.Fatalf("fired %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%q did not fire", want)
+	}
+}
+
+func expectNotFired(t *testing.T, fired <-chan string) {
+	t.Helper()
+
+	select {
+	case got := <-fired:
+		t.Fatalf("%q fired unexpectedly", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestScheduleFiresAtDeadline(t *testing.T) {
+	clock := newFakeClock()
+	scheduler := NewScheduler(clock)
+	defer scheduler.Stop()
+
+	fired := make(chan string, 1)
+	scheduler.Schedule("game", clock.Now().Add(10*time.Second), func() { fired <- "game" })
+
+	clock.Advance(9 * time.Second)
+	expectNotFired(t, fired)
+
+	clock.Advance(time.Second)
+	expectFired(t, fired, "game")
+
+	if _, ok := scheduler.Pending("game"); ok {
+		t.Fatal("deadline still pending after it fired")
+	}
+}
+
+func TestSchedulePastDeadlineFiresImmediately(t *testing.T) {
+	clock := newFakeClock()
+	scheduler := NewScheduler(clock)
+	defer scheduler.Stop()
+
+	fired := make(chan string, 1)
+	scheduler.Schedule("game", clock.Now().Add(-time.Second), func() { fired <- "game" })
+
+	expectFired(t, fired, "game")
+}
+
+func TestScheduleReplacesPendingDeadline(t *testing.T) {
+	clock := newFakeClock()
+	scheduler := NewScheduler(clock)
+	defer scheduler.Stop()
+
+	fired := make(chan string, 2)
+	scheduler.Schedule("game", clock.Now().Add(10*time.Second), func() { fired <- "first" })
+	scheduler.Schedule("game", clock.Now().Add(20*time.Second), func() { fired <- "second" })
+
+	deadline, ok := scheduler.Pending("game")
+	if !ok || !deadline.Equal(clock.Now().Add(20*time.Second)) {
+		t.Fatalf("pending deadline is %v, want the replacement", deadline)
+	}
+
+	clock.Advance(10 * time.Second)
+	expectNotFired(t, fired)
+
+	clock.Advance(10 * time.Second)
+	expectFired(t, fired, "second")
+	expectNotFired(t, fired)
+}
+
+func TestCancelDropsPendingDeadline(t *testing.T) {
+	clock := newFakeClock()
+	scheduler := NewScheduler(clock)
+	defer scheduler.Stop()
+
+	fired := make(chan string, 2)
+	scheduler.Schedule("cancelled", clock.Now().Add(10*time.Second), func() { fired <- "cancelled" })
+	scheduler.Schedule("kept", clock.Now().Add(10*time.Second), func() { fired <- "kept" })
+
+	scheduler.Cancel("cancelled")
+	if _, ok := scheduler.Pending("cancelled"); ok {
+		t.Fatal("deadline still pending after cancel")
+	}
+
+	clock.Advance(10 * time.Second)
+	expectFired(t, fired, "kept")
+	expectNotFired(t, fired)
+}
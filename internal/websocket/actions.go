@@ -0,0 +1,250 @@
+package websocket
+
+import (
+	"github.com/OddOneOutApp/backend/internal/services"
+	"github.com/OddOneOutApp/backend/internal/utils"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Actions in this file are shared by the websocket handlers and the REST API
+// so both validate and broadcast the same way.
+
+// SubmitGuess stores the last-chance guess of the caught impostor and relays
+// it to everyone. Unless the host judges guesses, and is not the one guessing,
+// the round ends right away.
+func SubmitGuess(db *gorm.DB, gameID string, userID datatypes.UUID, guess string) (*services.LastChance, error) {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	lastChance, err := game.SubmitGuess(db, userID, guess)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		return nil, err
+	}
+
+	isHost, err := game.IsHost(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A host that got caught cannot judge their own guess
+	if settings.GuessJudging == services.GuessJudgingAuto || isHost {
+		lastChance, err = game.AutoJudgeGuess(db)
+		if err != nil {
+			return nil, err
+		}
+		SendGuessMessage(gameID, lastChance)
+		EndGuessing(db, gameID, PhaseEndReasonPhaseComplete)
+		return lastChance, nil
+	}
+
+	SendGuessMessage(gameID, lastChance)
+	return lastChance, nil
+}
+
+// JudgeGuess lets the host decide whether the last-chance guess was right and
+// ends the round. The guess of a host is judged automatically instead.
+func JudgeGuess(db *gorm.DB, gameID string, hostID datatypes.UUID, correct bool) (*services.LastChance, error) {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = game.RequireHost(db, hostID)
+	if err != nil {
+		return nil, err
+	}
+
+	lastChance, err := game.GetLastChance(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// A host that got caught cannot judge their own guess
+	if lastChance != nil && lastChance.Impostor == hostID {
+		lastChance, err = game.AutoJudgeGuess(db)
+	} else {
+		lastChance, err = game.JudgeGuess(db, correct, services.GuessJudgingHost)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	SendGuessMessage(gameID, lastChance)
+	EndGuessing(db, gameID, PhaseEndReasonPhaseComplete)
+
+	return lastChance, nil
+}
+
+// SendChat stores a chat message and relays it to everyone in the game.
+func SendChat(db *gorm.DB, gameID string, userID datatypes.UUID, text string) (*services.ChatMessage, error) {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	chatMessage, err := game.AddChatMessage(db, userID, text)
+	if err != nil {
+		return nil, err
+	}
+
+	SendChatMessage(gameID, chatMessage)
+
+	return chatMessage, nil
+}
+
+func Rematch(db *gorm.DB, gameID string, userID datatypes.UUID) error {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		return err
+	}
+
+	err = game.RequireHost(db, userID)
+	if err != nil {
+		return err
+	}
+
+	err = game.Rematch(db)
+	if err != nil {
+		return err
+	}
+
+	SendRematchMessage(gameID, userID)
+	for _, connectedUserID := range HubInstance.connectedUsers(gameID) {
+		for _, conn := range HubInstance.userConnections(gameID, connectedUserID) {
+			SendInitMessage(gameID, conn, connectedUserID, db)
+		}
+	}
+	utils.Logger.Infof("Game %s reset for a rematch", gameID)
+
+	return nil
+}
+
+func UpdateSettings(db *gorm.DB, gameID string, userID datatypes.UUID, update services.SettingsUpdate) error {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		return err
+	}
+
+	err = game.RequireHost(db, userID)
+	if err != nil {
+		return err
+	}
+
+	settings, err := game.UpdateSettings(db, update)
+	if err != nil {
+		return err
+	}
+
+	SendSettingsMessage(gameID, settings)
+
+	return nil
+}
+
+// RemoveMember kicks or bans a player and closes their connection.
+func RemoveMember(db *gorm.DB, gameID string, hostID datatypes.UUID, targetID datatypes.UUID, ban bool) error {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		return err
+	}
+
+	err = game.RequireHost(db, hostID)
+	if err != nil {
+		return err
+	}
+
+	reason := "kicked"
+	kicked := true
+	if ban {
+		reason = "banned"
+		kicked, err = game.Ban(db, targetID)
+	} else {
+		err = game.Kick(db, targetID)
+	}
+	if err != nil {
+		return err
+	}
+	// A user that already left is only kept from coming back
+	if !kicked {
+		utils.Logger.Infof("User %s was banned from game %s after leaving", targetID, gameID)
+		return nil
+	}
+
+	SendKickedMessage(gameID, targetID, ban)
+	HubInstance.closeUser(gameID, targetID, CloseCodeRemoved, reason)
+	PresenceInstance.Remove(gameID, targetID)
+	utils.Logger.Infof("User %s was %s from game %s", targetID, reason, gameID)
+
+	return nil
+}
+
+func SetLocked(db *gorm.DB, gameID string, hostID datatypes.UUID, locked bool) error {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		return err
+	}
+
+	err = game.RequireHost(db, hostID)
+	if err != nil {
+		return err
+	}
+
+	err = game.SetLocked(db, locked)
+	if err != nil {
+		return err
+	}
+
+	SendLockMessage(gameID, hostID, locked)
+
+	return nil
+}
+
+// registerActionHooks tells the players about the actions taken through the
+// services.
+func registerActionHooks() {
+	services.AbsentUsers = func(gameID string) []datatypes.UUID {
+		return PresenceInstance.GoneUsers(gameID)
+	}
+
+	services.OnRoundStarted(func(db *gorm.DB, game *services.Game, round *services.Round, impostors []services.GameMember, promoted []services.GameMember) {
+		for _, spectator := range promoted {
+			SendRoleMessage(game.ID, spectator.UserID, services.MemberRolePlayer)
+		}
+
+		impostorUUIDs := make([]datatypes.UUID, 0, len(impostors))
+		for _, imp := range impostors {
+			impostorUUIDs = append(impostorUUIDs, imp.UserID)
+		}
+
+		settings, err := game.GetSettings(db)
+		if err != nil {
+			utils.Logger.Errorf("Error fetching settings for game %s: %v", game.ID, err)
+			return
+		}
+
+		SendQuestionMessage(game.ID, impostorUUIDs, round.RegularQuestion, round.SneakyQuestion, game.AnswersEndTime, round.Number, settings.RoundCount)
+		utils.Logger.Infof("Game %s round %d started", game.ID, round.Number)
+	})
+
+	// Everyone sees who answered so far, and the phase ends once everyone did
+	services.OnAnswer(func(db *gorm.DB, game *services.Game, answer *services.Answer) {
+		answered, err := game.GetAnsweredUserIDs(db)
+		if err != nil {
+			utils.Logger.Errorf("Error fetching answered users for game %s: %v", game.ID, err)
+			return
+		}
+		SendAnswerStatusMessage(game.ID, answer.UserID, answered)
+		CompleteAnsweringEarly(db, game)
+	})
+
+	services.OnVote(func(db *gorm.DB, game *services.Game, vote *services.Vote) {
+		CompleteVotingEarly(db, game)
+	})
+}
@@ -0,0 +1,279 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/OddOneOutApp/backend/internal/services"
+	"github.com/OddOneOutApp/backend/internal/utils"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Audience holds the read-only viewers of each game. Viewers are not game
+// members: they receive the public broadcasts and may vote while players
+// vote, but their votes are only tallied in memory and sent out in batches
+// so thousands of viewers do not cause a message per vote. Viewers have no
+// session, so votes are keyed by a viewer ID kept in a cookie to survive
+// reconnects.
+type Audience struct {
+	mu    sync.Mutex
+	games map[string]*audienceGame
+}
+
+type audienceGame struct {
+	connections map[*Connection]struct{}
+	targets     map[datatypes.UUID]bool   // Players that may be voted for, nil outside of voting
+	votes       map[string]datatypes.UUID // Viewer ID to the player they voted for
+	dirty       bool                      // Votes changed since the last tally was sent
+}
+
+var AudienceInstance *Audience
+
+// audienceMessageTypes are the broadcasts viewers get to see. Everything else
+// may reveal more than a player is meant to know.
+var audienceMessageTypes = map[MessageType]bool{
+	MessageTypeAnswers:       true,
+	MessageTypeVoting:        true,
+	MessageTypeVoteResult:    true,
+	MessageTypeStandings:     true,
+	MessageTypeAudienceTally: true,
+	MessageTypeGuessing:      true,
+	MessageTypeGuess:         true,
+}
+
+// NewAudience creates the audience registry and sends the tallies of all
+// games with new votes every interval.
+func NewAudience(interval time.Duration) *Audience {
+	audience := &Audience{
+		games: make(map[string]*audienceGame),
+	}
+	go audience.run(interval)
+	return audience
+}
+
+func (a *Audience) game(gameID string) *audienceGame {
+	game, ok := a.games[gameID]
+	if !ok {
+		game = &audienceGame{
+			connections: make(map[*Connection]struct{}),
+			votes:       make(map[string]datatypes.UUID),
+		}
+		a.games[gameID] = game
+	}
+	return game
+}
+
+// Add registers a viewer connection.
+func (a *Audience) Add(gameID string, conn *Connection) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.game(gameID).connections[conn] = struct{}{}
+}
+
+// Remove drops a viewer connection. Their vote still counts.
+func (a *Audience) Remove(gameID string, conn *Connection) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if game, ok := a.games[gameID]; ok {
+		delete(game.connections, conn)
+	}
+}
+
+// RemoveGame forgets the viewers of a deleted game and closes their
+// connections.
+func (a *Audience) RemoveGame(gameID string) {
+	a.mu.Lock()
+	game, ok := a.games[gameID]
+	delete(a.games, gameID)
+	a.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	for conn := range game.connections {
+		go conn.Close(CloseCodeGameDeleted, "game deleted")
+	}
+}
+
+// forward passes a broadcast of the game on to its viewers.
+func (a *Audience) forward(gameID string, data []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if game, ok := a.games[gameID]; ok {
+		for conn := range game.connections {
+			conn.SendMessage(data)
+		}
+	}
+}
+
+// Count returns the number of viewers connected to a game.
+func (a *Audience) Count(gameID string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if game, ok := a.games[gameID]; ok {
+		return len(game.connections)
+	}
+	return 0
+}
+
+// Vote records the vote of a viewer, replacing their earlier vote.
+func (a *Audience) Vote(gameID string, viewer string, targetID datatypes.UUID) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	game := a.game(gameID)
+	if game.targets == nil {
+		return newClientError(ErrorCodeActionNotAllowed, "audience voting is closed")
+	}
+	if !game.targets[targetID] {
+		return newClientError(ErrorCodeInvalidVote, services.ErrInvalidVoteTarget.Error())
+	}
+
+	if game.votes[viewer] != targetID {
+		game.votes[viewer] = targetID
+		game.dirty = true
+	}
+	return nil
+}
+
+// openVoting starts a fresh audience vote among the given players.
+func (a *Audience) openVoting(gameID string, targets []datatypes.UUID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	game := a.game(gameID)
+	game.targets = make(map[datatypes.UUID]bool, len(targets))
+	for _, target := range targets {
+		game.targets[target] = true
+	}
+	game.votes = make(map[string]datatypes.UUID)
+	game.dirty = false
+}
+
+// closeVoting stops accepting audience votes and returns their tally.
+func (a *Audience) closeVoting(gameID string) map[datatypes.UUID]int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	game, ok := a.games[gameID]
+	if !ok {
+		return nil
+	}
+	tally := game.tally()
+	game.targets = nil
+	game.votes = make(map[string]datatypes.UUID)
+	game.dirty = false
+	return tally
+}
+
+func (game *audienceGame) tally() map[datatypes.UUID]int {
+	tally := make(map[datatypes.UUID]int)
+	for _, target := range game.votes {
+		tally[target]++
+	}
+	return tally
+}
+
+func (a *Audience) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		a.flush()
+	}
+}
+
+// flush sends the current tally of every game whose audience votes changed.
+func (a *Audience) flush() {
+	tallies := make(map[string]map[datatypes.UUID]int)
+
+	a.mu.Lock()
+	for gameID, game := range a.games {
+		if game.dirty && game.targets != nil {
+			tallies[gameID] = game.tally()
+			game.dirty = false
+		}
+	}
+	a.mu.Unlock()
+
+	for gameID, tally := range tallies {
+		SendAudienceTallyMessage(gameID, tally)
+	}
+}
+
+// registerAudienceHooks opens the audience vote with the players' vote and
+// stores its tally once voting ends.
+func registerAudienceHooks() {
+	services.OnEnterState(services.GameStateVoting, func(db *gorm.DB, game *services.Game) {
+		answered, err := game.GetAnsweredUserIDs(db)
+		if err != nil {
+			utils.Logger.Errorf("Error fetching answered users of game %s: %s", game.ID, err)
+			return
+		}
+		AudienceInstance.openVoting(game.ID, answered)
+	})
+	services.OnExitState(services.GameStateVoting, func(db *gorm.DB, game *services.Game) {
+		tally := AudienceInstance.closeVoting(game.ID)
+		if len(tally) == 0 {
+			return
+		}
+		err := game.SaveAudienceTally(db, tally)
+		if err != nil {
+			utils.Logger.Errorf("Error saving audience tally of game %s: %s", game.ID, err)
+		}
+	})
+}
+
+// AudienceReadPump reads the votes of a viewer until their connection closes.
+// All connections of the same viewer share one vote.
+func (c *Connection) AudienceReadPump(gameID string, viewer string) {
+	defer func() {
+		c.Conn.Close()
+		close(c.done)
+		AudienceInstance.Remove(gameID, c)
+	}()
+
+	c.Conn.SetReadLimit(connectionLimits.MaxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(connectionLimits.PongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(connectionLimits.PongWait))
+	})
+
+	for {
+		_, message, err := c.Conn.ReadMessage()
+		if err != nil {
+			utils.Logger.Debugf("audience read error: %s", err)
+			break
+		}
+
+		var msg Message
+		if err := json.Unmarshal(message, &msg); err != nil {
+			c.sendDirect(errorMessage(gameID, c.UserID, "", newClientError(ErrorCodeInvalidMessage, "message is not valid JSON")))
+			continue
+		}
+		if msg.Type != MessageTypeVote {
+			c.sendDirect(errorMessage(gameID, c.UserID, msg.RequestID, newClientError(ErrorCodeUnknownType, "viewers can only vote")))
+			continue
+		}
+
+		target, ok := c.voteTargetFromContent(msg.Content)
+		if !ok {
+			c.sendDirect(errorMessage(gameID, c.UserID, msg.RequestID, newClientError(ErrorCodeInvalidPayload, "vote must be a user ID")))
+			continue
+		}
+		err = AudienceInstance.Vote(gameID, viewer, target)
+		if err != nil {
+			c.sendDirect(errorMessage(gameID, c.UserID, msg.RequestID, toClientError(err)))
+			continue
+		}
+		if msg.RequestID != "" {
+			c.sendDirect(ackMessage(gameID, c.UserID, msg.RequestID, msg.Type, nil))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package websocket
+
+import (
+	"errors"
+
+	"github.com/OddOneOutApp/backend/internal/services"
+	"gorm.io/gorm"
+)
+
+// ErrorCode is a stable, machine readable reason sent in error messages.
+type ErrorCode string
+
+const (
+	ErrorCodeInvalidMessage   ErrorCode = "invalid_message"
+	ErrorCodeUnknownType      ErrorCode = "unknown_message_type"
+	ErrorCodeInvalidPayload   ErrorCode = "invalid_payload"
+	ErrorCodeGameNotFound     ErrorCode = "game_not_found"
+	ErrorCodeNotInGame        ErrorCode = "not_in_game"
+	ErrorCodeNotHost          ErrorCode = "not_host"
+	ErrorCodeActionNotAllowed ErrorCode = "action_not_allowed"
+	ErrorCodeNoRoundsLeft     ErrorCode = "no_rounds_left"
+	ErrorCodeInvalidSettings  ErrorCode = "invalid_settings"
+	ErrorCodeInvalidVote      ErrorCode = "invalid_vote"
+	ErrorCodeAnsweringClosed  ErrorCode = "answering_closed"
+	ErrorCodeInvalidTarget    ErrorCode = "invalid_target"
+	ErrorCodeSpectator        ErrorCode = "spectator"
+	ErrorCodeRateLimited      ErrorCode = "rate_limited"
+	ErrorCodeInvalidGuess     ErrorCode = "invalid_guess"
+	ErrorCodeInternal         ErrorCode = "internal_error"
+)
+
+// ClientError is an error that is reported back to the client as is.
+type ClientError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (err *ClientError) Error() string {
+	return err.Message
+}
+
+func newClientError(code ErrorCode, message string) *ClientError {
+	return &ClientError{Code: code, Message: message}
+}
+
+// toClientError maps an error from the service layer to the code and message
+// the client gets to see. Unknown errors are reported as internal errors
+// without details.
+func toClientError(err error) *ClientError {
+	var clientErr *ClientError
+	var actionErr *services.ActionError
+	var transitionErr *services.TransitionError
+	var settingsErr *services.SettingsError
+
+	switch {
+	case errors.As(err, &clientErr):
+		return clientErr
+	case errors.As(err, &actionErr), errors.As(err, &transitionErr):
+		return newClientError(ErrorCodeActionNotAllowed, err.Error())
+	case errors.As(err, &settingsErr):
+		return newClientError(ErrorCodeInvalidSettings, err.Error())
+	case errors.Is(err, services.ErrNotInGame):
+		return newClientError(ErrorCodeNotInGame, err.Error())
+	case errors.Is(err, services.ErrNotHost):
+		return newClientError(ErrorCodeNotHost, err.Error())
+	case errors.Is(err, services.ErrNoRoundsLeft):
+		return newClientError(ErrorCodeNoRoundsLeft, err.Error())
+	case errors.Is(err, services.ErrInvalidVoteTarget), errors.Is(err, services.ErrVoteTargetNotInGame):
+		return newClientError(ErrorCodeInvalidVote, err.Error())
+	case errors.Is(err, services.ErrAnsweringClosed):
+		return newClientError(ErrorCodeAnsweringClosed, err.Error())
+	case errors.Is(err, services.ErrCannotKickHost):
+		return newClientError(ErrorCodeInvalidTarget, err.Error())
+	case errors.Is(err, services.ErrChatEmpty), errors.Is(err, services.ErrChatTooLong):
+		return newClientError(ErrorCodeInvalidPayload, err.Error())
+	case errors.Is(err, services.ErrChatRateLimited):
+		return newClientError(ErrorCodeRateLimited, err.Error())
+	case errors.Is(err, services.ErrNotGuesser), errors.Is(err, services.ErrAlreadyGuessed),
+		errors.Is(err, services.ErrGuessEmpty), errors.Is(err, services.ErrGuessTooLong),
+		errors.Is(err, services.ErrGuessingClosed), errors.Is(err, services.ErrNoGuess),
+		errors.Is(err, services.ErrGuessAlreadyJudged):
+		return newClientError(ErrorCodeInvalidGuess, err.Error())
+	case errors.Is(err, services.ErrSpectator):
+		return newClientError(ErrorCodeSpectator, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return newClientError(ErrorCodeGameNotFound, "game not found")
+	default:
+		return newClientError(ErrorCodeInternal, "internal server error")
+	}
+}
@@ -0,0 +1,69 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/OddOneOutApp/backend/internal/services"
+	"github.com/OddOneOutApp/backend/internal/services/timers"
+	"github.com/OddOneOutApp/backend/internal/utils"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// hostTimers holds the pending host migration of every game whose host lost
+// their connection, keyed by game ID.
+var hostTimers *timers.Scheduler
+
+var hostGracePeriod time.Duration
+
+// MigrateHost passes host ownership of a game to the longest-connected
+// remaining member and tells everyone about it.
+func MigrateHost(db *gorm.DB, gameID string) (*services.GameMember, error) {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	previousHost, err := game.GetHost(db)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	newHost, err := game.TransferHost(db, HubInstance.connectedUsers(gameID))
+	if err != nil {
+		return nil, err
+	}
+
+	var previousHostID datatypes.UUID
+	if previousHost != nil {
+		previousHostID = previousHost.UserID
+	}
+	SendHostChangedMessage(gameID, newHost.UserID, previousHostID)
+	utils.Logger.Infof("Host of game %s passed from %s to %s", gameID, previousHostID, newHost.UserID)
+
+	return newHost, nil
+}
+
+// scheduleHostMigration migrates the host of a game if they do not reconnect
+// within the grace period.
+func scheduleHostMigration(db *gorm.DB, gameID string, hostID datatypes.UUID) {
+	hostTimers.Schedule(gameID, services.Clock.Now().Add(hostGracePeriod), func() {
+		if HubInstance.isConnected(gameID, hostID) {
+			return
+		}
+
+		game, err := services.GetGameByID(db, gameID)
+		if err != nil {
+			return
+		}
+		isHost, err := game.IsHost(db, hostID)
+		if err != nil || !isHost {
+			return
+		}
+
+		_, err = MigrateHost(db, gameID)
+		if err != nil && err != services.ErrNoMembersLeft {
+			utils.Logger.Errorf("Error migrating host of game %s: %s", gameID, err)
+		}
+	})
+}
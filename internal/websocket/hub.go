@@ -2,97 +2,326 @@ package websocket
 
 import (
 	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/OddOneOutApp/backend/internal/config"
+	"github.com/OddOneOutApp/backend/internal/services"
+	"github.com/OddOneOutApp/backend/internal/services/timers"
 	"github.com/OddOneOutApp/backend/internal/utils"
 	"gorm.io/datatypes"
 )
 
 type Hub struct {
-	// Map of game IDs to a list of connections
-	Games map[string]map[datatypes.UUID]*Connection
+	// Map of game IDs to the open connections of each user. A user may be
+	// connected from several tabs or devices at once.
+	Games map[string]map[datatypes.UUID]map[Subscriber]struct{}
+	// Numbered history of the messages sent in each game
+	streams map[string]*eventStream
+	// Identifies this server run, sequence numbers start over after a restart
+	epoch string
 	mu    sync.RWMutex
 }
 
+// ResumePosition is where a reconnecting client left off: the last message it
+// saw and the server run that numbered it. Without an epoch the position is
+// taken to be from the current run.
+type ResumePosition struct {
+	Epoch string
+	Seq   uint64
+}
+
+// ParseResumePosition reads a position written as "<epoch>:<seq>", the form
+// used as event ID by the event stream, or as a bare sequence number.
+func ParseResumePosition(token string) (*ResumePosition, error) {
+	epoch, seq, found := strings.Cut(token, ":")
+	if !found {
+		epoch, seq = "", token
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &ResumePosition{Epoch: epoch, Seq: n}, nil
+}
+
+// eventID is the position after a message, as sent to event stream clients.
+func (h *Hub) eventID(seq uint64) string {
+	return fmt.Sprintf("%s:%d", h.epoch, seq)
+}
+
+// maxReplay is the most messages replayed on resume. Longer gaps get a fresh
+// init instead so the replay cannot fill the send buffer by itself.
+const maxReplay = sendBufferSize / 2
+
 var HubInstance *Hub
 
-func Init() {
+func Init(cfg *config.Config) {
 	HubInstance = NewHub()
+	Timers = timers.NewScheduler(services.Clock)
+	hostTimers = timers.NewScheduler(services.Clock)
+	hostGracePeriod = cfg.HostGracePeriod
+	PresenceInstance = NewPresence(cfg.PresenceGracePeriod)
+	AudienceInstance = NewAudience(cfg.AudienceTallyInterval)
+	connectionLimits = ConnectionLimits{
+		PingInterval:   cfg.PingInterval,
+		PongWait:       cfg.PongWait,
+		WriteWait:      cfg.WriteWait,
+		MaxMessageSize: cfg.MaxMessageSize,
+	}
+	registerPhaseHooks()
+	registerActionHooks()
+	registerAudienceHooks()
 	utils.Logger.Infoln("WebSocket Hub initialized")
 }
 
+// GameDeleted stops the timers of a deleted game, tells its players and
+// viewers and forgets everything kept about it in memory.
+func GameDeleted(gameID string) {
+	Timers.Cancel(gameID)
+	hostTimers.Cancel(gameID)
+	PresenceInstance.RemoveGame(gameID)
+	SendGameDeleteMessage(gameID)
+	HubInstance.RemoveGame(gameID)
+	AudienceInstance.RemoveGame(gameID)
+	MetricsInstance.RemoveGame(gameID)
+}
+
 func NewHub() *Hub {
 	return &Hub{
-		Games: make(map[string]map[datatypes.UUID]*Connection),
+		Games:   make(map[string]map[datatypes.UUID]map[Subscriber]struct{}),
+		streams: make(map[string]*eventStream),
+		epoch:   datatypes.NewUUIDv4().String(),
 	}
 }
 
-// Add a connection to a game
-func (h *Hub) AddConnection(gameID string, connection *Connection, userID datatypes.UUID) {
+// Add a connection to a game. Reports whether it is the user's first open
+// connection.
+func (h *Hub) AddConnection(gameID string, connection Subscriber, userID datatypes.UUID) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.addConnection(gameID, connection, userID)
+}
+
+// ResumeConnection adds a connection to a game and replays the messages the
+// user missed after the given position. It reports false if the position is
+// from another server run or the missed messages are no longer buffered or
+// too many, in which case the client needs a fresh init. Like AddConnection
+// it also reports whether this is the user's first open connection.
+func (h *Hub) ResumeConnection(gameID string, connection Subscriber, userID datatypes.UUID, position ResumePosition) (resumed bool, first bool) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	first = h.addConnection(gameID, connection, userID)
+
+	// A position from another run cannot match the stream of this one. One
+	// without an epoch is safe to try since a member who joined before a
+	// restart has no join mark in the new stream and gets a fresh init.
+	if position.Epoch != "" && position.Epoch != h.epoch {
+		return false, first
+	}
+	missed, ok := h.stream(gameID).since(position.Seq, userID)
+	if !ok || len(missed) > maxReplay {
+		return false, first
+	}
+	for _, e := range missed {
+		connection.SendMessage(e.data)
+	}
+	utils.Logger.Debugf("Replayed %d messages to user %s in game %s", len(missed), userID, gameID)
+	return true, first
+}
+
+// MemberJoined marks where the history of a new member starts, so they cannot
+// resume from before they joined.
+func (h *Hub) MemberJoined(gameID string, userID datatypes.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.stream(gameID).markJoined(userID)
+}
+
+// RemoveGame drops the message history of a deleted game.
+func (h *Hub) RemoveGame(gameID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.streams, gameID)
+}
+
+// lastSeq returns the sequence number of the latest message of a game.
+func (h *Hub) lastSeq(gameID string) uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if stream, ok := h.streams[gameID]; ok {
+		return stream.last
+	}
+	return 0
+}
+
+func (h *Hub) stream(gameID string) *eventStream {
+	stream, ok := h.streams[gameID]
+	if !ok {
+		stream = &eventStream{}
+		h.streams[gameID] = stream
+	}
+	return stream
+}
+
+func (h *Hub) addConnection(gameID string, connection Subscriber, userID datatypes.UUID) bool {
 	if _, ok := h.Games[gameID]; !ok {
-		h.Games[gameID] = make(map[datatypes.UUID]*Connection)
+		h.Games[gameID] = make(map[datatypes.UUID]map[Subscriber]struct{})
 	}
-	h.Games[gameID][userID] = connection
-	connection.UserID = userID
+	first := len(h.Games[gameID][userID]) == 0
+	if first {
+		h.Games[gameID][userID] = make(map[Subscriber]struct{})
+	}
+	h.Games[gameID][userID][connection] = struct{}{}
+	connection.attach(gameID, userID)
+	MetricsInstance.connectionOpened(gameID)
+	return first
 }
 
-// Remove a connection from a game
-func (h *Hub) removeConnection(gameID string, conn *Connection) {
+// Remove a connection from a game. Reports whether the user still has other
+// connections open.
+func (h *Hub) removeConnection(gameID string, userID datatypes.UUID, conn Subscriber) bool {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if connections, ok := h.Games[gameID]; ok {
-		delete(connections, conn.UserID)
-		if len(connections) == 0 {
-			delete(h.Games, gameID)
-		}
+	users, ok := h.Games[gameID]
+	if !ok {
+		return false
+	}
+	connections, ok := users[userID]
+	if !ok {
+		return false
+	}
+
+	delete(connections, conn)
+	if len(connections) > 0 {
+		return true
 	}
+	delete(users, userID)
+	if len(users) == 0 {
+		delete(h.Games, gameID)
+	}
+	return false
 }
 
-func (hub *Hub) broadcast(gameID string, message interface{}, exceptUserIDs ...datatypes.UUID) {
-	hub.mu.RLock()
-	defer hub.mu.RUnlock()
+// broadcast numbers a message and sends it to everyone in the game except the
+// given users. The hub is locked for the whole send so every connection sees
+// the messages in sequence order.
+func (hub *Hub) broadcast(gameID string, message Message, exceptUserIDs ...datatypes.UUID) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
 
+	stream := hub.stream(gameID)
+	message.Seq = stream.nextSeq()
 	data, err := json.Marshal(message)
 	if err != nil {
 		utils.Logger.Errorf("Failed to marshal message: %v", err)
 		return
 	}
-
-	var exceptList []datatypes.UUID
-	if len(exceptUserIDs) > 0 {
-		exceptList = exceptUserIDs
+	stream.add(event{seq: message.Seq, data: data, except: exceptUserIDs})
+	// Broadcasts that leave someone out carry secrets, e.g. the real question
+	if len(exceptUserIDs) == 0 && audienceMessageTypes[message.Type] {
+		AudienceInstance.forward(gameID, data)
 	}
 
-	if connections, ok := hub.Games[gameID]; ok {
-		for userID, connection := range connections {
-			if len(exceptList) == 0 || !contains(exceptList, userID) {
-				connection.SendMessage(data)
+	if users, ok := hub.Games[gameID]; ok {
+		for userID, connections := range users {
+			if !contains(exceptUserIDs, userID) {
+				for connection := range connections {
+					connection.SendMessage(data)
+				}
 				utils.Logger.Debugf("Broadcasting message to connection: %s", string(data))
 			}
 		}
 	}
 }
 
-func (hub *Hub) sendToUser(gameID string, userID datatypes.UUID, message interface{}) {
-	hub.mu.RLock()
-	defer hub.mu.RUnlock()
+// sendToUser numbers a message and sends it to all connections of one user.
+func (hub *Hub) sendToUser(gameID string, userID datatypes.UUID, message Message) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
 
+	stream := hub.stream(gameID)
+	message.Seq = stream.nextSeq()
 	data, err := json.Marshal(message)
 	if err != nil {
 		utils.Logger.Errorf("Failed to marshal message: %v", err)
 		return
 	}
+	stream.add(event{seq: message.Seq, data: data, userID: userID, private: true})
 
-	if connections, ok := hub.Games[gameID]; ok {
-		if conn, ok := connections[userID]; ok {
-			conn.SendMessage(data)
-			utils.Logger.Debugf("Sending message to user %s in game %s: %s", userID, gameID, string(data))
-		}
+	for conn := range hub.Games[gameID][userID] {
+		conn.SendMessage(data)
+		utils.Logger.Debugf("Sending message to user %s in game %s: %s", userID, gameID, string(data))
+	}
+}
+
+// sendInit sends a snapshot to a single connection, outside of the game's
+// message stream so the other tabs of the same user do not get it. The
+// snapshot carries the sequence number to resume from, and the hub stays
+// locked until it is queued so no later message overtakes it.
+func (hub *Hub) sendInit(gameID string, conn Subscriber, userID datatypes.UUID, snapshot *GameSnapshot) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	snapshot.Seq = hub.stream(gameID).last
+	data, err := json.Marshal(Message{
+		Type:    MessageTypeInit,
+		GameID:  gameID,
+		UserID:  userID,
+		Content: snapshot,
+	})
+	if err != nil {
+		utils.Logger.Errorf("Failed to marshal message: %v", err)
+		return
+	}
+	conn.SendMessage(data)
+}
+
+// userConnections returns the open connections of a user
+func (hub *Hub) userConnections(gameID string, userID datatypes.UUID) []Subscriber {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	connections := make([]Subscriber, 0, len(hub.Games[gameID][userID]))
+	for conn := range hub.Games[gameID][userID] {
+		connections = append(connections, conn)
+	}
+	return connections
+}
+
+// closeUser closes all connections of a user, e.g. after they were kicked
+func (hub *Hub) closeUser(gameID string, userID datatypes.UUID, code int, reason string) {
+	for _, conn := range hub.userConnections(gameID, userID) {
+		conn.Close(code, reason)
+	}
+}
+
+// isConnected reports whether a user has at least one open connection to a game
+func (hub *Hub) isConnected(gameID string, userID datatypes.UUID) bool {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	return len(hub.Games[gameID][userID]) > 0
+}
+
+// connectedUsers returns the IDs of all users with an open connection to a game
+func (hub *Hub) connectedUsers(gameID string) []datatypes.UUID {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	userIDs := make([]datatypes.UUID, 0, len(hub.Games[gameID]))
+	for userID := range hub.Games[gameID] {
+		userIDs = append(userIDs, userID)
 	}
+	return userIDs
 }
 
 // contains checks if a UUID is present in a slice of UUIDs
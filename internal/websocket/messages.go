@@ -10,27 +10,48 @@ import (
 )
 
 type Message struct {
-	Type    MessageType    `json:"type"`
-	Content interface{}    `json:"content"`
-	GameID  string         `json:"game_id"`
-	UserID  datatypes.UUID `json:"user_id"`
+	Type      MessageType    `json:"type"`
+	Content   interface{}    `json:"content"`
+	GameID    string         `json:"game_id"`
+	UserID    datatypes.UUID `json:"user_id"`
+	RequestID string         `json:"request_id,omitempty"` // Optional, set by clients to correlate replies
+	Seq       uint64         `json:"seq,omitempty"`        // Set by the server, increases with every message of a game
 }
 
 type MessageType string
 
 const (
-	MessageTypeJoin       MessageType = "join"
-	MessageTypeLeave      MessageType = "leave"
-	MessageTypeGameDelete MessageType = "game_delete"
-	MessageTypeUserStatus MessageType = "user_status"
-	MessageTypeInit       MessageType = "init"
-	MessageTypeUpdateUser MessageType = "update_user"
-	MessageTypeStart      MessageType = "start" // sent by client
-	MessageTypeQuestion   MessageType = "question"
-	MessageTypeAnswer     MessageType = "answer" // sent by client
-	MessageTypeAnswers    MessageType = "answers"
-	MessageTypeVote       MessageType = "vote" // sent by client
-	MessageTypeVoteResult MessageType = "vote_result"
+	MessageTypeJoin           MessageType = "join"
+	MessageTypeLeave          MessageType = "leave"
+	MessageTypeGameDelete     MessageType = "game_delete"
+	MessageTypeUserStatus     MessageType = "user_status"
+	MessageTypeInit           MessageType = "init"
+	MessageTypeUpdateUser     MessageType = "update_user"
+	MessageTypeStart          MessageType = "start" // sent by client
+	MessageTypeQuestion       MessageType = "question"
+	MessageTypeAnswer         MessageType = "answer" // sent by client
+	MessageTypeAnswers        MessageType = "answers"
+	MessageTypeVote           MessageType = "vote" // sent by client
+	MessageTypeVoteResult     MessageType = "vote_result"
+	MessageTypeStandings      MessageType = "standings"
+	MessageTypeRematch        MessageType = "rematch"         // sent by client, echoed to everyone once the lobby is reset
+	MessageTypeUpdateSettings MessageType = "update_settings" // sent by client
+	MessageTypeSettings       MessageType = "settings"
+	MessageTypeError          MessageType = "error"
+	MessageTypeAck            MessageType = "ack"
+	MessageTypeAnswerStatus   MessageType = "answer_status"
+	MessageTypeKick           MessageType = "kick" // sent by client
+	MessageTypeBan            MessageType = "ban"  // sent by client
+	MessageTypeKicked         MessageType = "kicked"
+	MessageTypeLock           MessageType = "lock" // sent by client, echoed to everyone once applied
+	MessageTypeHostChanged    MessageType = "host_changed"
+	MessageTypeRole           MessageType = "role"
+	MessageTypeAudienceTally  MessageType = "audience_tally"
+	MessageTypeVoting         MessageType = "voting"
+	MessageTypeChat           MessageType = "chat" // sent by client, relayed to everyone once stored
+	MessageTypeGuessing       MessageType = "guessing"
+	MessageTypeGuess          MessageType = "guess"       // sent by client, relayed to everyone once stored
+	MessageTypeJudgeGuess     MessageType = "judge_guess" // sent by client
 )
 
 func SendJoinMessage(gameID string, userID datatypes.UUID, username string) {
@@ -57,82 +78,29 @@ func SendGameDeleteMessage(gameID string) {
 	})
 }
 
-func SendUserStatusMessage(gameID string, userID datatypes.UUID, active bool) {
+func SendUserStatusMessage(gameID string, userID datatypes.UUID) {
+	status, lastSeen := PresenceInstance.Status(gameID, userID)
 	HubInstance.broadcast(gameID, Message{
-		Type:    MessageTypeUserStatus,
-		GameID:  gameID,
-		UserID:  userID,
-		Content: active,
+		Type:   MessageTypeUserStatus,
+		GameID: gameID,
+		UserID: userID,
+		Content: map[string]interface{}{
+			"active":    status == PresenceOnline,
+			"status":    status,
+			"last_seen": unixOrZero(lastSeen),
+		},
 	}, userID)
 }
 
-func SendInitMessage(gameID string, userID datatypes.UUID, db *gorm.DB) {
-	game, err := services.GetGameByID(db, gameID)
+// SendInitMessage sends the state of the game to one connection of a user.
+func SendInitMessage(gameID string, conn Subscriber, userID datatypes.UUID, db *gorm.DB) {
+	snapshot, err := BuildSnapshot(db, gameID, userID)
 	if err != nil {
-		utils.Logger.Errorf("Error fetching game by ID: %v", err)
+		utils.Logger.Errorf("Error building snapshot of game %s: %v", gameID, err)
 		return
 	}
 
-	var users []UserInfo
-	members, err := game.GetMembers(db)
-	if err != nil {
-		utils.Logger.Errorf("Error fetching game members: %v", err)
-		return
-	}
-	for _, member := range members {
-		userSession, err := services.GetSessionByID(db, member.UserID)
-		if err != nil {
-			utils.Logger.Errorf("Error fetching session by ID: %v", err)
-			continue
-		}
-
-		connection := HubInstance.Games[gameID][member.UserID]
-		if connection == nil {
-			utils.Logger.Debugf("Connection not found for user ID: %s", member.UserID)
-		}
-		users = append(users, UserInfo{
-			ID:     member.UserID,
-			Name:   userSession.Username,
-			Active: connection != nil,
-			Host:   member.Host,
-			Vote:   member.Vote,
-		})
-		utils.Logger.Debugf("User %s is in game %s", member.UserID, gameID)
-	}
-
-	question, err := game.GetQuestionForUser(db, userID)
-	if err != nil {
-		utils.Logger.Errorf("Error fetching question for user %s in game %s: %v", userID, gameID, err)
-		question = ""
-	}
-
-	actualQuestion := game.RegularQuestion
-
-	answers, err := game.GetAnswers(db)
-	if err != nil {
-		utils.Logger.Errorf("Error fetching answers for game %s: %v", gameID, err)
-		answers = []services.Answer{}
-	}
-
-	if !(game.State == services.GameStateVoting || game.State == services.GameStateFinished) {
-		actualQuestion = ""
-		answers = []services.Answer{}
-	}
-
-	HubInstance.sendToUser(gameID, userID, Message{
-		Type:   MessageTypeInit,
-		GameID: gameID,
-		UserID: userID,
-		Content: map[string]interface{}{
-			"users":            users,
-			"game_state":       game.State,
-			"answers_end_time": game.AnswersEndTime.Unix(),
-			"voting_end_time":  game.VotingEndTime.Unix(),
-			"question":         question,
-			"actual_question":  actualQuestion,
-			"answers":          answers,
-		},
-	})
+	HubInstance.sendInit(gameID, conn, userID, snapshot)
 }
 
 func SendUpdateUserMessage(gameID string, userID datatypes.UUID, username string) {
@@ -144,13 +112,15 @@ func SendUpdateUserMessage(gameID string, userID datatypes.UUID, username string
 	}, userID)
 }
 
-func SendQuestionMessage(gameID string, impostorUUIDs []datatypes.UUID, question string, impostorQuestion string, gameEnd time.Time) {
+func SendQuestionMessage(gameID string, impostorUUIDs []datatypes.UUID, question string, impostorQuestion string, gameEnd time.Time, round int, roundCount int) {
 	HubInstance.broadcast(gameID, Message{
 		Type:   MessageTypeQuestion,
 		GameID: gameID,
 		Content: map[string]interface{}{
 			"question":         question,
 			"answers_end_time": gameEnd.Unix(),
+			"round":            round,
+			"round_count":      roundCount,
 		},
 	}, impostorUUIDs...)
 
@@ -162,40 +132,261 @@ func SendQuestionMessage(gameID string, impostorUUIDs []datatypes.UUID, question
 			Content: map[string]interface{}{
 				"question":         impostorQuestion,
 				"answers_end_time": gameEnd.Unix(),
+				"round":            round,
+				"round_count":      roundCount,
 			},
 		})
 	}
 
 }
 
-func SendAnswersMessage(gameID string, answers []services.Answer, actualQuestion string, votingEnd time.Time) {
+// SendAnswersMessage reveals the answers once answering ended. The following
+// phase is either the discussion or voting, whichever end time is set.
+func SendAnswersMessage(gameID string, answers []services.Answer, actualQuestion string, discussionEnd time.Time, votingEnd time.Time, reason PhaseEndReason) {
 	HubInstance.broadcast(gameID, Message{
 		Type:   MessageTypeAnswers,
 		GameID: gameID,
 		Content: map[string]interface{}{
-			"answers":         answers,
-			"actual_question": actualQuestion,
+			"answers":             answers,
+			"actual_question":     actualQuestion,
+			"discussion_end_time": unixOrZero(discussionEnd),
+			"voting_end_time":     unixOrZero(votingEnd),
+			"reason":              reason,
+		},
+	})
+}
+
+// SendVotingMessage tells everyone that the discussion is over and voting
+// opened.
+func SendVotingMessage(gameID string, votingEnd time.Time, reason PhaseEndReason) {
+	HubInstance.broadcast(gameID, Message{
+		Type:   MessageTypeVoting,
+		GameID: gameID,
+		Content: map[string]interface{}{
 			"voting_end_time": votingEnd.Unix(),
+			"reason":          reason,
+		},
+	})
+}
+
+// SendGuessingMessage tells everyone that voting is over and the caught
+// impostor gets a last chance to guess the real question.
+func SendGuessingMessage(gameID string, impostor datatypes.UUID, guessEnd time.Time, reason PhaseEndReason) {
+	HubInstance.broadcast(gameID, Message{
+		Type:   MessageTypeGuessing,
+		GameID: gameID,
+		Content: map[string]interface{}{
+			"impostor":       impostor,
+			"guess_end_time": guessEnd.Unix(),
+			"reason":         reason,
+		},
+	})
+}
+
+func SendGuessMessage(gameID string, lastChance *services.LastChance) {
+	HubInstance.broadcast(gameID, Message{
+		Type:    MessageTypeGuess,
+		GameID:  gameID,
+		UserID:  lastChance.Impostor,
+		Content: lastChance,
+	})
+}
+
+func SendChatMessage(gameID string, chatMessage *services.ChatMessage) {
+	HubInstance.broadcast(gameID, Message{
+		Type:    MessageTypeChat,
+		GameID:  gameID,
+		UserID:  chatMessage.UserID,
+		Content: chatMessage,
+	})
+}
+
+func SendVoteResultMessage(gameID string, result *services.RoundResult, reason PhaseEndReason) {
+	HubInstance.broadcast(gameID, Message{
+		Type:   MessageTypeVoteResult,
+		GameID: gameID,
+		Content: struct {
+			*services.RoundResult
+			Reason PhaseEndReason `json:"reason"`
+		}{result, reason},
+	})
+}
+
+func SendStandingsMessage(gameID string, standings []services.Standing, round int, roundCount int) {
+	HubInstance.broadcast(gameID, Message{
+		Type:   MessageTypeStandings,
+		GameID: gameID,
+		Content: map[string]interface{}{
+			"standings":   standings,
+			"round":       round,
+			"round_count": roundCount,
+			"final":       round >= roundCount,
+		},
+	})
+}
+
+func SendRematchMessage(gameID string, hostID datatypes.UUID) {
+	HubInstance.broadcast(gameID, Message{
+		Type:   MessageTypeRematch,
+		GameID: gameID,
+		UserID: hostID,
+		Content: map[string]interface{}{
+			"game_state": services.GameStateLobby,
 		},
 	})
 }
 
-func SendVoteResultMessage(gameID string, votes map[datatypes.UUID]datatypes.UUID) {
-	stringVotes := make(map[string]string, len(votes))
-	for k, v := range votes {
-		stringVotes[k.String()] = v.String()
+func SendSettingsMessage(gameID string, settings *services.GameSettings) {
+	HubInstance.broadcast(gameID, Message{
+		Type:    MessageTypeSettings,
+		GameID:  gameID,
+		Content: settings,
+	})
+}
+
+func errorMessage(gameID string, userID datatypes.UUID, requestID string, err *ClientError) Message {
+	return Message{
+		Type:      MessageTypeError,
+		GameID:    gameID,
+		UserID:    userID,
+		RequestID: requestID,
+		Content: map[string]interface{}{
+			"code":       err.Code,
+			"message":    err.Message,
+			"request_id": requestID,
+		},
 	}
+}
+
+// SendAnswerStatusMessage tells everyone who has submitted an answer so far
+// without revealing what they answered.
+func SendAnswerStatusMessage(gameID string, userID datatypes.UUID, answered []datatypes.UUID) {
+	HubInstance.broadcast(gameID, Message{
+		Type:   MessageTypeAnswerStatus,
+		GameID: gameID,
+		UserID: userID,
+		Content: map[string]interface{}{
+			"answered": answered,
+		},
+	})
+}
+
+func SendKickedMessage(gameID string, userID datatypes.UUID, banned bool) {
 	HubInstance.broadcast(gameID, Message{
-		Type:    MessageTypeVoteResult,
+		Type:   MessageTypeKicked,
+		GameID: gameID,
+		UserID: userID,
+		Content: map[string]interface{}{
+			"banned": banned,
+		},
+	})
+}
+
+func SendLockMessage(gameID string, hostID datatypes.UUID, locked bool) {
+	HubInstance.broadcast(gameID, Message{
+		Type:    MessageTypeLock,
 		GameID:  gameID,
-		Content: stringVotes,
+		UserID:  hostID,
+		Content: locked,
 	})
 }
 
+func SendHostChangedMessage(gameID string, newHostID datatypes.UUID, previousHostID datatypes.UUID) {
+	HubInstance.broadcast(gameID, Message{
+		Type:   MessageTypeHostChanged,
+		GameID: gameID,
+		UserID: newHostID,
+		Content: map[string]interface{}{
+			"previous_host": previousHostID,
+		},
+	})
+}
+
+// SendRoleMessage tells everyone whether a member plays or spectates.
+func SendRoleMessage(gameID string, userID datatypes.UUID, role services.MemberRole) {
+	HubInstance.broadcast(gameID, Message{
+		Type:    MessageTypeRole,
+		GameID:  gameID,
+		UserID:  userID,
+		Content: role,
+	})
+}
+
+// SendAckMessage confirms to the connection an action came from that it was
+// persisted. It is only sent if the client supplied a request ID to correlate
+// it with.
+func SendAckMessage(gameID string, conn *Connection, requestID string, ackedType MessageType, result interface{}) {
+	if requestID == "" {
+		return
+	}
+	conn.sendDirect(ackMessage(gameID, conn.UserID, requestID, ackedType, result))
+}
+
+func ackMessage(gameID string, userID datatypes.UUID, requestID string, ackedType MessageType, result interface{}) Message {
+	return Message{
+		Type:      MessageTypeAck,
+		GameID:    gameID,
+		UserID:    userID,
+		RequestID: requestID,
+		Content: map[string]interface{}{
+			"request_id": requestID,
+			"type":       ackedType,
+			"result":     result,
+		},
+	}
+}
+
+// SendAudienceTallyMessage tells players and viewers how the audience voted
+// so far.
+func SendAudienceTallyMessage(gameID string, tally map[datatypes.UUID]int) {
+	votes := 0
+	tallyByID := make(map[string]int, len(tally))
+	for target, count := range tally {
+		tallyByID[target.String()] = count
+		votes += count
+	}
+
+	HubInstance.broadcast(gameID, Message{
+		Type:   MessageTypeAudienceTally,
+		GameID: gameID,
+		Content: map[string]interface{}{
+			"votes":   votes,
+			"tally":   tallyByID,
+			"viewers": AudienceInstance.Count(gameID),
+		},
+	})
+}
+
+// SendAudienceInitMessage sends a new viewer the public state of the game.
+func SendAudienceInitMessage(db *gorm.DB, gameID string, conn *Connection) error {
+	snapshot, err := BuildSnapshot(db, gameID, conn.UserID)
+	if err != nil {
+		return err
+	}
+	snapshot.Question = ""
+	// Chat stays among the players, it is not forwarded to viewers either
+	snapshot.Chat = []services.ChatMessage{}
+
+	HubInstance.sendInit(gameID, conn, conn.UserID, snapshot)
+	return nil
+}
+
 type UserInfo struct {
-	ID     datatypes.UUID `json:"id"`
-	Name   string         `json:"name"`
-	Active bool           `json:"active"`
-	Host   bool           `json:"host"`
-	Vote   datatypes.UUID `json:"vote,omitempty"` // Optional, only set if the user has voted
+	ID       datatypes.UUID      `json:"id"`
+	Name     string              `json:"name"`
+	Active   bool                `json:"active"`
+	Status   PresenceStatus      `json:"status"`
+	LastSeen int64               `json:"last_seen"` // Unix time, 0 if the user never connected
+	Host     bool                `json:"host"`
+	Vote     datatypes.UUID      `json:"vote,omitempty"` // Optional, only set if the user has voted
+	Score    int                 `json:"score"`
+	Role     services.MemberRole `json:"role"`
+}
+
+// unixOrZero converts a time to Unix time, keeping the zero time at 0.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
 }
@@ -0,0 +1,106 @@
+package websocket
+
+import "sync"
+
+// GameMetrics counts the traffic of a single game.
+type GameMetrics struct {
+	Connections             int64 `json:"connections"` // Connections opened so far
+	Messages                int64 `json:"messages"`    // Messages queued for delivery
+	DroppedMessages         int64 `json:"dropped_messages"`
+	SlowConsumerDisconnects int64 `json:"slow_consumer_disconnects"`
+}
+
+// Metrics counts the traffic of every running game, keyed by game ID.
+type Metrics struct {
+	mu    sync.Mutex
+	games map[string]*GameMetrics
+}
+
+var MetricsInstance = NewMetrics()
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		games: make(map[string]*GameMetrics),
+	}
+}
+
+// game returns the counters of a game, creating them on first use. The caller
+// must hold the lock.
+func (m *Metrics) game(gameID string) *GameMetrics {
+	counters, ok := m.games[gameID]
+	if !ok {
+		counters = &GameMetrics{}
+		m.games[gameID] = counters
+	}
+	return counters
+}
+
+func (m *Metrics) connectionOpened(gameID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.game(gameID).Connections++
+}
+
+func (m *Metrics) messageSent(gameID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.game(gameID).Messages++
+}
+
+func (m *Metrics) messageDropped(gameID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.game(gameID).DroppedMessages++
+}
+
+func (m *Metrics) slowConsumerDisconnected(gameID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.game(gameID).SlowConsumerDisconnects++
+}
+
+// RemoveGame forgets the counters of a deleted game.
+func (m *Metrics) RemoveGame(gameID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.games, gameID)
+}
+
+// Game returns the counters of a single game.
+func (m *Metrics) Game(gameID string) GameMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counters, ok := m.games[gameID]
+	if !ok {
+		return GameMetrics{}
+	}
+	return *counters
+}
+
+// MetricsSnapshot sums up the counters of all games. Game IDs are left out
+// since they double as join codes.
+type MetricsSnapshot struct {
+	Games int `json:"games"` // Games with any traffic
+	GameMetrics
+}
+
+// Snapshot returns the totals of the counters of all running games.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := MetricsSnapshot{Games: len(m.games)}
+	for _, counters := range m.games {
+		snapshot.Connections += counters.Connections
+		snapshot.Messages += counters.Messages
+		snapshot.DroppedMessages += counters.DroppedMessages
+		snapshot.SlowConsumerDisconnects += counters.SlowConsumerDisconnects
+	}
+	return snapshot
+}
@@ -0,0 +1,325 @@
+package websocket
+
+import (
+	"errors"
+	"time"
+
+	"github.com/OddOneOutApp/backend/internal/services"
+	"github.com/OddOneOutApp/backend/internal/services/timers"
+	"github.com/OddOneOutApp/backend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// PhaseEndReason tells clients why a phase ended.
+type PhaseEndReason string
+
+const (
+	PhaseEndReasonTimeout       PhaseEndReason = "timeout"
+	PhaseEndReasonPhaseComplete PhaseEndReason = "phase_complete"
+)
+
+// Timers holds the pending phase deadline of every running game, keyed by
+// game ID.
+var Timers *timers.Scheduler
+
+// registerPhaseHooks keeps the phase timers in step with the game state
+// machine.
+func registerPhaseHooks() {
+	services.OnExitState(services.GameStateAnswering, func(db *gorm.DB, game *services.Game) {
+		Timers.Cancel(game.ID)
+	})
+	services.OnExitState(services.GameStateDiscussion, func(db *gorm.DB, game *services.Game) {
+		Timers.Cancel(game.ID)
+	})
+	services.OnExitState(services.GameStateVoting, func(db *gorm.DB, game *services.Game) {
+		Timers.Cancel(game.ID)
+	})
+	services.OnExitState(services.GameStateGuessing, func(db *gorm.DB, game *services.Game) {
+		Timers.Cancel(game.ID)
+	})
+	services.OnEnterState(services.GameStateAnswering, func(db *gorm.DB, game *services.Game) {
+		scheduleAnsweringEnd(db, game.ID, game.AnswersEndTime)
+	})
+	services.OnEnterState(services.GameStateDiscussion, func(db *gorm.DB, game *services.Game) {
+		scheduleDiscussionEnd(db, game.ID, game.DiscussionEndTime)
+	})
+	services.OnEnterState(services.GameStateVoting, func(db *gorm.DB, game *services.Game) {
+		scheduleVotingEnd(db, game.ID, game.VotingEndTime)
+	})
+	services.OnEnterState(services.GameStateGuessing, func(db *gorm.DB, game *services.Game) {
+		scheduleGuessingEnd(db, game.ID, game.GuessEndTime)
+	})
+}
+
+func scheduleAnsweringEnd(db *gorm.DB, gameID string, deadline time.Time) {
+	Timers.Schedule(gameID, deadline, func() {
+		EndAnswering(db, gameID, PhaseEndReasonTimeout)
+	})
+}
+
+func scheduleDiscussionEnd(db *gorm.DB, gameID string, deadline time.Time) {
+	Timers.Schedule(gameID, deadline, func() {
+		EndDiscussion(db, gameID, PhaseEndReasonTimeout)
+	})
+}
+
+func scheduleVotingEnd(db *gorm.DB, gameID string, deadline time.Time) {
+	Timers.Schedule(gameID, deadline, func() {
+		EndVoting(db, gameID, PhaseEndReasonTimeout)
+	})
+}
+
+func scheduleGuessingEnd(db *gorm.DB, gameID string, deadline time.Time) {
+	Timers.Schedule(gameID, deadline, func() {
+		EndGuessing(db, gameID, PhaseEndReasonTimeout)
+	})
+}
+
+// EndAnswering closes the answering phase of a game and opens the discussion,
+// or voting right away if the game has no discussion phase.
+func EndAnswering(db *gorm.DB, gameID string, reason PhaseEndReason) {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching game %s: %s", gameID, err)
+		return
+	}
+	if game.State != services.GameStateAnswering {
+		return
+	}
+
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching settings: %s", err)
+		return
+	}
+
+	var discussionEnd, votingEnd time.Time
+	if settings.DiscussionSeconds > 0 {
+		discussionEnd = services.Clock.Now().Add(time.Duration(settings.DiscussionSeconds) * time.Second)
+		err = game.SetDiscussionEndTimeAndGameState(db, discussionEnd)
+	} else {
+		votingEnd = services.Clock.Now().Add(time.Duration(settings.VotingSeconds) * time.Second)
+		err = game.SetVotingEndTimeAndGameState(db, votingEnd)
+	}
+	if err != nil {
+		logTransitionError(gameID, err)
+		return
+	}
+
+	answers, err := game.GetAnswers(db)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching answers: %s", err)
+		return
+	}
+
+	// With a last-chance guess the real question is only revealed with the
+	// results, so a caught impostor cannot copy it
+	actualQuestion := game.RegularQuestion
+	if settings.LastChanceGuess {
+		actualQuestion = ""
+	}
+
+	SendAnswersMessage(game.ID, answers, actualQuestion, discussionEnd, votingEnd, reason)
+	utils.Logger.Infof("Game %s answers finished (%s)", game.ID, reason)
+}
+
+// EndDiscussion closes the discussion phase of a game and opens voting.
+func EndDiscussion(db *gorm.DB, gameID string, reason PhaseEndReason) {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching game %s: %s", gameID, err)
+		return
+	}
+	if game.State != services.GameStateDiscussion {
+		return
+	}
+
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching settings: %s", err)
+		return
+	}
+
+	votingEnd := services.Clock.Now().Add(time.Duration(settings.VotingSeconds) * time.Second)
+	err = game.SetVotingEndTimeAndGameState(db, votingEnd)
+	if err != nil {
+		logTransitionError(gameID, err)
+		return
+	}
+
+	SendVotingMessage(game.ID, game.VotingEndTime, reason)
+	utils.Logger.Infof("Game %s discussion finished (%s)", game.ID, reason)
+}
+
+// EndVoting closes the voting phase of a game. A caught impostor gets a last
+// chance to guess the real question, otherwise the round is scored right away.
+func EndVoting(db *gorm.DB, gameID string, reason PhaseEndReason) {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching game %s: %s", gameID, err)
+		return
+	}
+	if game.State != services.GameStateVoting {
+		return
+	}
+
+	guesser, ok, err := game.GetLastChanceGuesser(db)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching round outcome: %s", err)
+		return
+	}
+	if !ok {
+		finishRound(db, game, reason)
+		return
+	}
+
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching settings: %s", err)
+		return
+	}
+
+	guessEnd := services.Clock.Now().Add(time.Duration(settings.GuessSeconds) * time.Second)
+	err = game.StartGuessing(db, guesser, guessEnd)
+	if err != nil {
+		logTransitionError(gameID, err)
+		return
+	}
+
+	SendGuessingMessage(game.ID, guesser, guessEnd, reason)
+	utils.Logger.Infof("Game %s round %d voting finished (%s)", game.ID, game.CurrentRound, reason)
+}
+
+// EndGuessing closes the last-chance guess of a game and scores the round. A
+// guess the host did not judge in time is judged automatically, no guess at
+// all counts as wrong.
+func EndGuessing(db *gorm.DB, gameID string, reason PhaseEndReason) {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching game %s: %s", gameID, err)
+		return
+	}
+	if game.State != services.GameStateGuessing {
+		return
+	}
+
+	lastChance, err := game.GetLastChance(db)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching guess: %s", err)
+		return
+	}
+	if lastChance != nil && lastChance.Guess != "" && !lastChance.Judged {
+		_, err = game.AutoJudgeGuess(db)
+		if err != nil && err != services.ErrGuessAlreadyJudged {
+			utils.Logger.Errorf("Error judging guess: %s", err)
+			return
+		}
+	}
+
+	finishRound(db, game, reason)
+}
+
+// finishRound scores the current round and sends the results.
+func finishRound(db *gorm.DB, game *services.Game, reason PhaseEndReason) {
+	result, err := game.FinishRound(db)
+	if err != nil {
+		logTransitionError(game.ID, err)
+		return
+	}
+
+	standings, err := game.GetStandings(db)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching standings: %s", err)
+		return
+	}
+
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching settings: %s", err)
+		return
+	}
+
+	SendVoteResultMessage(game.ID, result, reason)
+	SendStandingsMessage(game.ID, standings, game.CurrentRound, settings.RoundCount)
+	utils.Logger.Infof("Game %s round %d finished (%s)", game.ID, game.CurrentRound, reason)
+}
+
+// CompleteAnsweringEarly ends the answering phase once every player that is
+// not gone answered, unless the host turned early completion off.
+func CompleteAnsweringEarly(db *gorm.DB, game *services.Game) {
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching settings: %s", err)
+		return
+	}
+	if !settings.EarlyCompletion {
+		return
+	}
+
+	done, err := game.AllMembersAnswered(db, PresenceInstance.GoneUsers(game.ID))
+	if err != nil {
+		utils.Logger.Errorf("Error checking answers: %s", err)
+		return
+	}
+	if done {
+		EndAnswering(db, game.ID, PhaseEndReasonPhaseComplete)
+	}
+}
+
+// CompleteVotingEarly ends the voting phase once every player that is not
+// gone voted, unless the host turned early completion off.
+func CompleteVotingEarly(db *gorm.DB, game *services.Game) {
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching settings: %s", err)
+		return
+	}
+	if !settings.EarlyCompletion {
+		return
+	}
+
+	done, err := game.AllMembersVoted(db, PresenceInstance.GoneUsers(game.ID))
+	if err != nil {
+		utils.Logger.Errorf("Error checking votes: %s", err)
+		return
+	}
+	if done {
+		EndVoting(db, game.ID, PhaseEndReasonPhaseComplete)
+	}
+}
+
+// logTransitionError logs failed phase transitions. Losing the race against a
+// concurrent transition of the same phase is expected and not an error.
+func logTransitionError(gameID string, err error) {
+	var transitionErr *services.TransitionError
+	if errors.As(err, &transitionErr) {
+		utils.Logger.Debugf("Game %s already left the phase: %s", gameID, err)
+		return
+	}
+	utils.Logger.Errorf("Error saving game %s: %s", gameID, err)
+}
+
+// RestorePhaseTimers schedules the deadlines of all games that were running
+// when the server stopped. Deadlines that already passed fire right away.
+func RestorePhaseTimers(db *gorm.DB) {
+	var games []services.Game
+	err := db.Where("state IN ?", []services.GameState{services.GameStateAnswering, services.GameStateDiscussion, services.GameStateVoting, services.GameStateGuessing}).Find(&games).Error
+	if err != nil {
+		utils.Logger.Errorf("Error fetching running games: %s", err)
+		return
+	}
+
+	for _, game := range games {
+		switch game.State {
+		case services.GameStateAnswering:
+			scheduleAnsweringEnd(db, game.ID, game.AnswersEndTime)
+		case services.GameStateDiscussion:
+			scheduleDiscussionEnd(db, game.ID, game.DiscussionEndTime)
+		case services.GameStateVoting:
+			scheduleVotingEnd(db, game.ID, game.VotingEndTime)
+		case services.GameStateGuessing:
+			scheduleGuessingEnd(db, game.ID, game.GuessEndTime)
+		}
+	}
+	utils.Logger.Infof("Restored phase timers for %d games", len(games))
+}
@@ -0,0 +1,227 @@
+package websocket
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/OddOneOutApp/backend/internal/config"
+	"github.com/OddOneOutApp/backend/internal/services"
+	"github.com/OddOneOutApp/backend/internal/services/timers"
+	"github.com/OddOneOutApp/backend/internal/utils"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var clock = timers.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+func TestMain(m *testing.M) {
+	utils.InitializeLogger()
+
+	// The questions are read relative to the repository root
+	err := os.Chdir("../..")
+	if err != nil {
+		panic(err)
+	}
+	services.InitializeQuestionService()
+
+	services.Clock = clock
+	Init(&config.Config{
+		HostGracePeriod:       30 * time.Second,
+		PresenceGracePeriod:   60 * time.Second,
+		PingInterval:          30 * time.Second,
+		PongWait:              60 * time.Second,
+		WriteWait:             10 * time.Second,
+		MaxMessageSize:        4096,
+		AudienceTallyInterval: 2 * time.Second,
+	})
+
+	os.Exit(m.Run())
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The phase timers write from their own goroutine
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	err = db.AutoMigrate(&services.Game{}, &services.GameSettings{}, &services.GameMember{}, &services.Session{}, &services.Round{}, &services.Answer{}, &services.Vote{}, &services.Ban{}, &services.AudienceVote{}, &services.ChatMessage{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestGame creates a lobby with the host and three more players.
+func newTestGame(t *testing.T, db *gorm.DB) (*services.Game, []datatypes.UUID) {
+	t.Helper()
+
+	users := []datatypes.UUID{datatypes.NewUUIDv4(), datatypes.NewUUIDv4(), datatypes.NewUUIDv4(), datatypes.NewUUIDv4()}
+	game, err := services.CreateGame(db, &config.Config{}, users[0], "Life", 1, services.DefaultScoringMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range users[1:] {
+		_, err = game.Join(db, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return game, users
+}
+
+func gameState(t *testing.T, db *gorm.DB, gameID string) services.GameState {
+	t.Helper()
+
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return game.State
+}
+
+// expectState waits for the timers to move the game into the wanted state.
+func expectState(t *testing.T, db *gorm.DB, gameID string, want services.GameState) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		state := gameState(t, db, gameID)
+		if state == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("game is in state %q, want %q", state, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// expectStateKept checks the timers leave the game alone for a moment.
+func expectStateKept(t *testing.T, db *gorm.DB, gameID string, want services.GameState) {
+	t.Helper()
+
+	time.Sleep(50 * time.Millisecond)
+	state := gameState(t, db, gameID)
+	if state != want {
+		t.Fatalf("game moved to state %q before its deadline, want %q", state, want)
+	}
+}
+
+func TestPhasesEndAtTheirDeadlines(t *testing.T) {
+	db := newTestDB(t)
+	game, users := newTestGame(t, db)
+
+	_, err := services.StartRound(db, game.ID, users[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answerTime := time.Duration(settings.AnswerSeconds) * time.Second
+	votingTime := time.Duration(settings.VotingSeconds) * time.Second
+
+	clock.Advance(answerTime - time.Second)
+	expectStateKept(t, db, game.ID, services.GameStateAnswering)
+
+	clock.Advance(time.Second)
+	expectState(t, db, game.ID, services.GameStateVoting)
+
+	clock.Advance(votingTime - time.Second)
+	expectStateKept(t, db, game.ID, services.GameStateVoting)
+
+	// Nobody voted, so the impostor got away and there is nothing to guess
+	clock.Advance(time.Second)
+	expectState(t, db, game.ID, services.GameStateFinished)
+}
+
+func TestAnswersCloseAtDeadline(t *testing.T) {
+	db := newTestDB(t)
+	game, users := newTestGame(t, db)
+
+	_, err := services.StartRound(db, game.ID, users[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	game, err = services.GetGameByID(db, game.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancel the timer so the deadline is checked while still answering
+	Timers.Cancel(game.ID)
+	clock.Advance(game.AnswersEndTime.Sub(clock.Now()) + time.Second)
+
+	_, err = game.AddAnswer(db, users[1], "too late")
+	if err != services.ErrAnsweringClosed {
+		t.Fatalf("late answer returned %v, want %v", err, services.ErrAnsweringClosed)
+	}
+}
+
+func TestGuessingEndsAtDeadline(t *testing.T) {
+	db := newTestDB(t)
+	game, users := newTestGame(t, db)
+
+	_, err := services.StartRound(db, game.ID, users[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	impostors, err := game.GetImpostors(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	impostor := impostors[0].UserID
+
+	// Everyone answers, which ends answering early
+	for _, userID := range users {
+		_, err = services.SubmitAnswer(db, game.ID, userID, "an answer")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectState(t, db, game.ID, services.GameStateVoting)
+
+	// Everyone catches the impostor, which ends voting early
+	for _, userID := range users {
+		target := impostor
+		if userID == impostor {
+			target = users[0]
+			if impostor == users[0] {
+				target = users[1]
+			}
+		}
+		_, err = services.CastVote(db, game.ID, userID, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectState(t, db, game.ID, services.GameStateGuessing)
+
+	guessTime := time.Duration(settings.GuessSeconds) * time.Second
+	clock.Advance(guessTime - time.Second)
+	expectStateKept(t, db, game.ID, services.GameStateGuessing)
+
+	clock.Advance(time.Second)
+	expectState(t, db, game.ID, services.GameStateFinished)
+}
@@ -0,0 +1,205 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/OddOneOutApp/backend/internal/services"
+	"github.com/OddOneOutApp/backend/internal/services/timers"
+	"github.com/OddOneOutApp/backend/internal/utils"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type PresenceStatus string
+
+const (
+	PresenceOnline       PresenceStatus = "online"
+	PresenceReconnecting PresenceStatus = "reconnecting" // Disconnected, still within the grace period
+	PresenceGone         PresenceStatus = "gone"         // Disconnected for longer than the grace period
+)
+
+type presenceEntry struct {
+	status   PresenceStatus
+	lastSeen time.Time
+}
+
+// Presence tracks when each member of a game was last seen and whether they
+// are still around. Members that stay disconnected longer than the grace
+// period are considered gone until they reconnect.
+type Presence struct {
+	mu          sync.Mutex
+	games       map[string]map[datatypes.UUID]*presenceEntry
+	gracePeriod time.Duration
+	timers      *timers.Scheduler
+}
+
+var PresenceInstance *Presence
+
+func NewPresence(gracePeriod time.Duration) *Presence {
+	return &Presence{
+		games:       make(map[string]map[datatypes.UUID]*presenceEntry),
+		gracePeriod: gracePeriod,
+		timers:      timers.NewScheduler(services.Clock),
+	}
+}
+
+func presenceKey(gameID string, userID datatypes.UUID) string {
+	return gameID + "/" + userID.String()
+}
+
+func (p *Presence) entry(gameID string, userID datatypes.UUID) *presenceEntry {
+	if _, ok := p.games[gameID]; !ok {
+		p.games[gameID] = make(map[datatypes.UUID]*presenceEntry)
+	}
+	e, ok := p.games[gameID][userID]
+	if !ok {
+		e = &presenceEntry{}
+		p.games[gameID][userID] = e
+	}
+	return e
+}
+
+func (p *Presence) set(gameID string, userID datatypes.UUID, status PresenceStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e := p.entry(gameID, userID)
+	e.status = status
+	e.lastSeen = services.Clock.Now()
+}
+
+// Connected marks a member as online.
+func (p *Presence) Connected(gameID string, userID datatypes.UUID) {
+	p.timers.Cancel(presenceKey(gameID, userID))
+	p.set(gameID, userID, PresenceOnline)
+}
+
+// Seen refreshes the last seen time of a member.
+func (p *Presence) Seen(gameID string, userID datatypes.UUID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.games[gameID][userID]; ok {
+		e.lastSeen = services.Clock.Now()
+	}
+}
+
+// Joined starts tracking a new member before their first connection. Until
+// they connect they count as reconnecting, and they are gone if they do not
+// connect within the grace period, so they cannot hold up a phase forever.
+func (p *Presence) Joined(db *gorm.DB, gameID string, userID datatypes.UUID) {
+	p.mu.Lock()
+	if _, ok := p.games[gameID][userID]; ok {
+		p.mu.Unlock()
+		return
+	}
+	p.entry(gameID, userID).status = PresenceReconnecting
+	p.mu.Unlock()
+
+	p.scheduleGone(db, gameID, userID)
+}
+
+// Disconnected marks a member as reconnecting and declares them gone once the
+// grace period passed without a new connection. Members that were already
+// removed are ignored.
+func (p *Presence) Disconnected(db *gorm.DB, gameID string, userID datatypes.UUID) {
+	p.mu.Lock()
+	e, ok := p.games[gameID][userID]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	e.status = PresenceReconnecting
+	e.lastSeen = services.Clock.Now()
+	p.mu.Unlock()
+
+	p.scheduleGone(db, gameID, userID)
+}
+
+// scheduleGone declares a reconnecting member gone once the grace period
+// passed.
+func (p *Presence) scheduleGone(db *gorm.DB, gameID string, userID datatypes.UUID) {
+	p.timers.Schedule(presenceKey(gameID, userID), services.Clock.Now().Add(p.gracePeriod), func() {
+		p.mu.Lock()
+		e, ok := p.games[gameID][userID]
+		if !ok || e.status != PresenceReconnecting {
+			p.mu.Unlock()
+			return
+		}
+		e.status = PresenceGone
+		p.mu.Unlock()
+
+		utils.Logger.Infof("User %s in game %s is gone", userID, gameID)
+		SendUserStatusMessage(gameID, userID)
+
+		// The member no longer holds up the current phase
+		game, err := services.GetGameByID(db, gameID)
+		if err != nil {
+			return
+		}
+		switch game.State {
+		case services.GameStateAnswering:
+			CompleteAnsweringEarly(db, game)
+		case services.GameStateVoting:
+			CompleteVotingEarly(db, game)
+		}
+	})
+}
+
+// Remove forgets a member, e.g. after they left or were kicked.
+func (p *Presence) Remove(gameID string, userID datatypes.UUID) {
+	p.timers.Cancel(presenceKey(gameID, userID))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if members, ok := p.games[gameID]; ok {
+		delete(members, userID)
+		if len(members) == 0 {
+			delete(p.games, gameID)
+		}
+	}
+}
+
+// RemoveGame forgets all members of a deleted game.
+func (p *Presence) RemoveGame(gameID string) {
+	p.mu.Lock()
+	userIDs := make([]datatypes.UUID, 0, len(p.games[gameID]))
+	for userID := range p.games[gameID] {
+		userIDs = append(userIDs, userID)
+	}
+	delete(p.games, gameID)
+	p.mu.Unlock()
+
+	for _, userID := range userIDs {
+		p.timers.Cancel(presenceKey(gameID, userID))
+	}
+}
+
+// Status returns the presence of a member. Members that never connected are
+// reported as reconnecting since they may still show up.
+func (p *Presence) Status(gameID string, userID datatypes.UUID) (PresenceStatus, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, ok := p.games[gameID][userID]
+	if !ok {
+		return PresenceReconnecting, time.Time{}
+	}
+	return e.status, e.lastSeen
+}
+
+// GoneUsers returns the members of a game that are gone.
+func (p *Presence) GoneUsers(gameID string) []datatypes.UUID {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var userIDs []datatypes.UUID
+	for userID, e := range p.games[gameID] {
+		if e.status == PresenceGone {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs
+}
@@ -0,0 +1,177 @@
+package websocket
+
+import (
+	"github.com/OddOneOutApp/backend/internal/services"
+	"github.com/OddOneOutApp/backend/internal/utils"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// GameSnapshot is the full state of a game as one user gets to see it. It is
+// sent as the init message and served by the REST API.
+type GameSnapshot struct {
+	Users             []UserInfo             `json:"users"`
+	GameState         services.GameState     `json:"game_state"`
+	AnswersEndTime    int64                  `json:"answers_end_time"`
+	DiscussionEndTime int64                  `json:"discussion_end_time"`
+	VotingEndTime     int64                  `json:"voting_end_time"`
+	GuessEndTime      int64                  `json:"guess_end_time"`
+	Question          string                 `json:"question"`
+	ActualQuestion    string                 `json:"actual_question"`
+	Answers           []services.Answer      `json:"answers"`
+	Answered          []datatypes.UUID       `json:"answered"`
+	Round             int                    `json:"round"`
+	RoundCount        int                    `json:"round_count"`
+	Result            *services.RoundResult  `json:"result"`
+	LastChance        *services.LastChance   `json:"last_chance,omitempty"` // Only set while the caught impostor guesses
+	Settings          *services.GameSettings `json:"settings"`
+	Locked            bool                   `json:"locked"`
+	Chat              []services.ChatMessage `json:"chat"`
+	Seq               uint64                 `json:"seq,omitempty"` // Last message of the game, set when served outside of the message stream
+	Epoch             string                 `json:"epoch"`         // Server run the sequence numbers belong to, sent back on resume
+}
+
+// BuildSnapshot collects the state of a game for a user. Questions and
+// answers are only revealed once the game got far enough.
+func BuildSnapshot(db *gorm.DB, gameID string, userID datatypes.UUID) (*GameSnapshot, error) {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []UserInfo{}
+	members, err := game.GetMembers(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		userSession, err := services.GetSessionByID(db, member.UserID)
+		if err != nil {
+			utils.Logger.Errorf("Error fetching session by ID: %v", err)
+			continue
+		}
+
+		connected := HubInstance.isConnected(gameID, member.UserID)
+		if !connected {
+			utils.Logger.Debugf("Connection not found for user ID: %s", member.UserID)
+		}
+		status, lastSeen := PresenceInstance.Status(gameID, member.UserID)
+		users = append(users, UserInfo{
+			ID:       member.UserID,
+			Name:     userSession.Username,
+			Active:   connected,
+			Status:   status,
+			LastSeen: unixOrZero(lastSeen),
+			Host:     member.Host,
+			Vote:     member.Vote,
+			Score:    member.Score,
+			Role:     member.Role,
+		})
+		utils.Logger.Debugf("User %s is in game %s", member.UserID, gameID)
+	}
+
+	question, err := game.GetQuestionForUser(db, userID)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching question for user %s in game %s: %v", userID, gameID, err)
+		question = ""
+	}
+
+	actualQuestion := game.RegularQuestion
+
+	answers, err := game.GetAnswers(db)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching answers for game %s: %v", gameID, err)
+		answers = []services.Answer{}
+	}
+
+	answered := make([]datatypes.UUID, 0, len(answers))
+	for _, answer := range answers {
+		answered = append(answered, answer.UserID)
+	}
+
+	settings, err := game.GetSettings(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if !(game.State == services.GameStateDiscussion || game.State == services.GameStateVoting || game.State == services.GameStateGuessing || game.State == services.GameStateRoundEnd || game.State == services.GameStateFinished) {
+		actualQuestion = ""
+		answers = []services.Answer{}
+	}
+	// A caught impostor could just copy the real question as their guess
+	if settings.LastChanceGuess && game.State != services.GameStateRoundEnd && game.State != services.GameStateFinished {
+		actualQuestion = ""
+	}
+
+	var result *services.RoundResult
+	if game.State == services.GameStateRoundEnd || game.State == services.GameStateFinished {
+		result, err = game.GetRoundResult(db)
+		if err != nil {
+			utils.Logger.Errorf("Error fetching round result for game %s: %v", gameID, err)
+			result = nil
+		}
+	}
+
+	var lastChance *services.LastChance
+	if game.State == services.GameStateGuessing {
+		lastChance, err = game.GetLastChance(db)
+		if err != nil {
+			utils.Logger.Errorf("Error fetching guess for game %s: %v", gameID, err)
+			lastChance = nil
+		}
+	}
+
+	chat, err := game.GetChatMessages(db)
+	if err != nil {
+		utils.Logger.Errorf("Error fetching chat of game %s: %v", gameID, err)
+		chat = []services.ChatMessage{}
+	}
+
+	return &GameSnapshot{
+		Users:             users,
+		GameState:         game.State,
+		AnswersEndTime:    game.AnswersEndTime.Unix(),
+		DiscussionEndTime: unixOrZero(game.DiscussionEndTime),
+		VotingEndTime:     game.VotingEndTime.Unix(),
+		GuessEndTime:      unixOrZero(game.GuessEndTime),
+		Question:          question,
+		ActualQuestion:    actualQuestion,
+		Answers:           answers,
+		Answered:          answered,
+		Round:             game.CurrentRound,
+		RoundCount:        settings.RoundCount,
+		Result:            result,
+		LastChance:        lastChance,
+		Settings:          settings,
+		Locked:            game.Locked,
+		Chat:              chat,
+		Epoch:             HubInstance.epoch,
+	}, nil
+}
+
+// GetState returns the snapshot of a game for one of its members, along with
+// the sequence number to resume the message stream from.
+func GetState(db *gorm.DB, gameID string, userID datatypes.UUID) (*GameSnapshot, error) {
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		return nil, err
+	}
+	inGame, err := game.IsUserInGame(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !inGame {
+		return nil, services.ErrNotInGame
+	}
+
+	// Read the sequence number first so nothing sent while building the
+	// snapshot is skipped on resume
+	seq := HubInstance.lastSeq(gameID)
+	snapshot, err := BuildSnapshot(db, gameID, userID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Seq = seq
+
+	return snapshot, nil
+}
@@ -0,0 +1,147 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/OddOneOutApp/backend/internal/utils"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// SSEConnection streams the messages of a game as Server-Sent Events, for
+// clients on networks that block websocket upgrades. Clients send their
+// actions through the REST API instead.
+type SSEConnection struct {
+	Send      chan []byte
+	UserID    datatypes.UUID
+	GameID    string
+	closeOnce sync.Once
+	slow      sync.Once
+	closed    chan struct{}
+	reason    closeReason
+}
+
+type closeReason struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+func NewSSEConnection() *SSEConnection {
+	return &SSEConnection{
+		Send:   make(chan []byte, sendBufferSize),
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *SSEConnection) attach(gameID string, userID datatypes.UUID) {
+	c.GameID = gameID
+	c.UserID = userID
+}
+
+// SendMessage follows the same backpressure policy as websocket connections.
+func (c *SSEConnection) SendMessage(message []byte) {
+	select {
+	case c.Send <- message:
+		MetricsInstance.messageSent(c.GameID)
+	default:
+		MetricsInstance.messageDropped(c.GameID)
+		c.slow.Do(func() {
+			utils.Logger.Warnf("send buffer of user %s in game %s full, disconnecting", c.UserID, c.GameID)
+			MetricsInstance.slowConsumerDisconnected(c.GameID)
+			c.Close(CloseCodeSlowConsumer, "slow consumer")
+		})
+	}
+}
+
+// Close ends the stream after a final close event carrying the reason.
+func (c *SSEConnection) Close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.reason = closeReason{Code: code, Reason: reason}
+		close(c.closed)
+	})
+}
+
+// Serve writes events until the client goes away or the connection is
+// closed, then runs the usual disconnect bookkeeping. Comments are sent every
+// ping interval to keep proxies from timing out the stream and to detect dead
+// peers.
+func (c *SSEConnection) Serve(db *gorm.DB, w http.ResponseWriter, done <-chan struct{}) {
+	defer unsubscribe(db, c.GameID, c.UserID, c)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		utils.Logger.Errorf("response writer does not support flushing")
+		return
+	}
+	controller := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(connectionLimits.PingInterval)
+	defer ticker.Stop()
+
+	write := func(format string, args ...interface{}) bool {
+		controller.SetWriteDeadline(time.Now().Add(connectionLimits.WriteWait))
+		_, err := fmt.Fprintf(w, format, args...)
+		if err != nil {
+			utils.Logger.Debugf("sse write error: %s", err)
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	for {
+		select {
+		case message := <-c.Send:
+			// The ID comes back as Last-Event-ID when the browser reconnects
+			if seq := messageSeq(message); seq != 0 {
+				if !write("id: %s\n", HubInstance.eventID(seq)) {
+					return
+				}
+			}
+			if !write("data: %s\n\n", message) {
+				return
+			}
+		case <-ticker.C:
+			if !write(": ping\n\n") {
+				return
+			}
+		case <-c.closed:
+			data, _ := json.Marshal(c.reason)
+			write("event: close\ndata: %s\n\n", data)
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// messageSeq reads the sequence number of an encoded message. An init message
+// is not numbered itself but carries the one of the snapshot it holds.
+func messageSeq(message []byte) uint64 {
+	var numbered struct {
+		Type    MessageType `json:"type"`
+		Seq     uint64      `json:"seq"`
+		Content struct {
+			Seq uint64 `json:"seq"`
+		} `json:"content"`
+	}
+	err := json.Unmarshal(message, &numbered)
+	if err != nil {
+		return 0
+	}
+	if numbered.Type == MessageTypeInit {
+		return numbered.Content.Seq
+	}
+	return numbered.Seq
+}
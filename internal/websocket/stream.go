@@ -0,0 +1,85 @@
+package websocket
+
+import (
+	"gorm.io/datatypes"
+)
+
+// eventBufferSize is how many events are kept per game for clients that
+// resume after a reconnect.
+const eventBufferSize = 256
+
+// event is a sent message kept for replay along with who received it.
+type event struct {
+	seq     uint64
+	data    []byte
+	userID  datatypes.UUID   // Set for messages to a single user
+	except  []datatypes.UUID // Users left out of a broadcast
+	private bool
+}
+
+func (e *event) isFor(userID datatypes.UUID) bool {
+	if e.private {
+		return e.userID == userID
+	}
+	return !contains(e.except, userID)
+}
+
+// eventStream numbers the messages of a game and keeps the latest ones in a
+// ring buffer.
+type eventStream struct {
+	last   uint64
+	events []event
+	start  int                       // Index of the oldest event once the buffer is full
+	joined map[datatypes.UUID]uint64 // Last event before each member joined
+}
+
+func (s *eventStream) nextSeq() uint64 {
+	s.last++
+	return s.last
+}
+
+func (s *eventStream) add(e event) {
+	if len(s.events) < eventBufferSize {
+		s.events = append(s.events, e)
+		return
+	}
+	s.events[s.start] = e
+	s.start = (s.start + 1) % eventBufferSize
+}
+
+// markJoined remembers where a new member's history starts.
+func (s *eventStream) markJoined(userID datatypes.UUID) {
+	if s.joined == nil {
+		s.joined = make(map[datatypes.UUID]uint64)
+	}
+	s.joined[userID] = s.last
+}
+
+// since returns the events after seq meant for a user. It reports false if
+// the buffer no longer holds all of them. A client at seq 0 never saw a
+// message, not even an init, so it has nothing to resume. Neither is anything
+// from before the user joined replayed, e.g. the question of a round a
+// spectator joined in the middle of.
+func (s *eventStream) since(seq uint64, userID datatypes.UUID) ([]event, bool) {
+	if seq == 0 || seq > s.last {
+		return nil, false
+	}
+	if joinedAt, ok := s.joined[userID]; !ok || seq < joinedAt {
+		return nil, false
+	}
+	if seq == s.last {
+		return nil, true
+	}
+	if len(s.events) == 0 || s.events[s.start].seq > seq+1 {
+		return nil, false
+	}
+
+	var missed []event
+	for i := 0; i < len(s.events); i++ {
+		e := s.events[(s.start+i)%len(s.events)]
+		if e.seq > seq && e.isFor(userID) {
+			missed = append(missed, e)
+		}
+	}
+	return missed, true
+}
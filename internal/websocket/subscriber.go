@@ -0,0 +1,72 @@
+package websocket
+
+import (
+	"github.com/OddOneOutApp/backend/internal/services"
+	"github.com/OddOneOutApp/backend/internal/utils"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Subscriber receives the messages of a game, whatever transport carries
+// them to the client.
+type Subscriber interface {
+	// SendMessage queues an encoded message without blocking.
+	SendMessage(data []byte)
+	// Close ends the subscription, telling the client why if the transport
+	// allows it.
+	Close(code int, reason string)
+	attach(gameID string, userID datatypes.UUID)
+}
+
+// Subscribe adds a subscriber to a game and announces the user, unless
+// another tab or device of theirs is already connected. With a resume
+// position set, the messages missed after it are replayed instead of sending
+// a fresh init if they are still buffered.
+func Subscribe(db *gorm.DB, gameID string, userID datatypes.UUID, username string, sub Subscriber, resume *ResumePosition) {
+	resumed, first := false, false
+	if resume != nil {
+		resumed, first = HubInstance.ResumeConnection(gameID, sub, userID, *resume)
+	} else {
+		first = HubInstance.AddConnection(gameID, sub, userID)
+	}
+	PresenceInstance.Connected(gameID, userID)
+
+	if !resumed {
+		SendInitMessage(gameID, sub, userID, db)
+	}
+	if first {
+		SendJoinMessage(gameID, userID, username)
+		SendUserStatusMessage(gameID, userID)
+	}
+
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		return
+	}
+	member, err := game.GetMember(db, userID)
+	if err == nil && member.Role == services.MemberRoleSpectator {
+		SendRoleMessage(gameID, userID, member.Role)
+	}
+}
+
+// unsubscribe removes a subscriber that went away. Once the user has no
+// subscriber left they count as reconnecting, and a host gets replaced if
+// they do not come back in time.
+func unsubscribe(db *gorm.DB, gameID string, userID datatypes.UUID, sub Subscriber) {
+	// Another tab or device of the same user keeps them present
+	if HubInstance.removeConnection(gameID, userID, sub) {
+		return
+	}
+
+	PresenceInstance.Disconnected(db, gameID, userID)
+	SendUserStatusMessage(gameID, userID)
+
+	game, err := services.GetGameByID(db, gameID)
+	if err != nil {
+		return
+	}
+	if isHost, err := game.IsHost(db, userID); err == nil && isHost {
+		scheduleHostMigration(db, gameID, userID)
+	}
+	utils.Logger.Debugf("User %s unsubscribed from game %s", userID, gameID)
+}
@@ -2,50 +2,103 @@ package websocket
 
 import (
 	"net/http"
-	"strconv"
+	"sync"
 	"time"
 
 	"encoding/json"
 
 	"github.com/OddOneOutApp/backend/internal/services"
 	"github.com/OddOneOutApp/backend/internal/utils"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 type Connection struct {
-	Conn   *websocket.Conn
-	Send   chan []byte
-	UserID datatypes.UUID
+	Conn      *websocket.Conn
+	Send      chan []byte
+	UserID    datatypes.UUID
+	GameID    string
+	Protocol  int // Version of the client message format, see ProtocolLegacy
+	closeOnce sync.Once
+	slow      sync.Once
+	done      chan struct{} // Closed once the read pump stopped
 }
 
-func NewConnection(w http.ResponseWriter, r *http.Request) (*Connection, error) {
+const (
+	// ProtocolLegacy clients may still send vote targets as JSON arrays of
+	// 16 bytes.
+	ProtocolLegacy = 1
+	// ProtocolCurrent clients send all user IDs as UUID strings.
+	ProtocolCurrent = 2
+)
+
+// ConnectionLimits configures the heartbeat and size limits of websocket
+// connections.
+type ConnectionLimits struct {
+	PingInterval   time.Duration
+	PongWait       time.Duration
+	WriteWait      time.Duration
+	MaxMessageSize int64
+}
+
+var connectionLimits ConnectionLimits
+
+// sendBufferSize is how many messages may queue up for a client before it
+// counts as a slow consumer.
+const sendBufferSize = 256
+
+const (
+	// CloseCodeRemoved is the websocket close code sent to players that were
+	// kicked or banned by the host.
+	CloseCodeRemoved = 4000
+	// CloseCodeSlowConsumer is sent to clients that could not keep up with
+	// the messages of their game. They get a fresh init once they reconnect.
+	CloseCodeSlowConsumer = 4001
+	// CloseCodeGameDeleted is sent to viewers once the game they watch is
+	// deleted.
+	CloseCodeGameDeleted = 4002
+)
+
+// NewConnection upgrades a request to a websocket connection. The response
+// header is sent along with the upgrade, e.g. to set cookies.
+func NewConnection(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*Connection, error) {
 	upgrader := websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
 			return true // Adjust for production
 		},
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Connection{
-		Conn: conn,
-		Send: make(chan []byte, 256),
+		Conn:     conn,
+		Send:     make(chan []byte, sendBufferSize),
+		Protocol: ProtocolCurrent,
+		done:     make(chan struct{}),
 	}, nil
 }
 
-func (c *Connection) ReadPump(db *gorm.DB, hub *Hub, gameID string) {
+func (c *Connection) ReadPump(db *gorm.DB, gameID string) {
 	defer func() {
-		hub.removeConnection(gameID, c)
 		c.Conn.Close()
-
-		SendUserStatusMessage(gameID, c.UserID, false)
+		close(c.done)
+		unsubscribe(db, gameID, c.UserID, c)
 	}()
 
+	// A peer that stops answering pings runs into the read deadline and goes
+	// through the disconnect bookkeeping above
+	c.Conn.SetReadLimit(connectionLimits.MaxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(connectionLimits.PongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		PresenceInstance.Seen(gameID, c.UserID)
+		return c.Conn.SetReadDeadline(time.Now().Add(connectionLimits.PongWait))
+	})
+
 	for {
 		_, message, err := c.Conn.ReadMessage()
 		if err != nil {
@@ -54,142 +107,346 @@ func (c *Connection) ReadPump(db *gorm.DB, hub *Hub, gameID string) {
 		}
 
 		utils.Logger.Debugf("Received message: %s", message)
+		PresenceInstance.Seen(gameID, c.UserID)
 		var msg Message
 		if err := json.Unmarshal(message, &msg); err != nil {
 			utils.Logger.Errorf("failed to unmarshal message: %s", err)
+			c.sendError(gameID, "", newClientError(ErrorCodeInvalidMessage, "message is not valid JSON"))
 			continue
 		}
 
-		switch msg.Type {
-		case MessageTypeStart:
-			utils.Logger.Debugf("Game %s started", gameID)
+		if action, ok := messageActions[msg.Type]; ok {
 			game, err := services.GetGameByID(db, gameID)
 			if err != nil {
 				utils.Logger.Errorf("failed to get game: %s", err)
+				c.sendError(gameID, msg.RequestID, err)
 				continue
 			}
+			if err := game.CanPerform(action); err != nil {
+				utils.Logger.Debugf("rejected %s from user %s in game %s: %s", msg.Type, c.UserID, gameID, err)
+				c.sendError(gameID, msg.RequestID, err)
+				continue
+			}
+		}
 
-			host, err := game.GetHost(db)
+		switch msg.Type {
+		case MessageTypeStart:
+			_, err := services.StartRound(db, gameID, c.UserID)
 			if err != nil {
-				utils.Logger.Errorf("failed to get game host: %s", err)
+				utils.Logger.Errorf("failed to start round in game %s: %s", gameID, err)
+				c.sendError(gameID, msg.RequestID, err)
 				continue
 			}
-			if host.UserID != c.UserID {
-				utils.Logger.Errorf("user %s is not the host of game %s", c.UserID, gameID)
+
+		case MessageTypeAnswer:
+			utils.Logger.Debugf("Received answer: %s", msg.Content)
+
+			answer, ok := msg.Content.(string)
+			if !ok {
+				utils.Logger.Errorf("msg.Content is not a string")
+				c.sendError(gameID, msg.RequestID, newClientError(ErrorCodeInvalidPayload, "answer must be a string"))
 				continue
 			}
 
-			var seconds int
-			switch v := msg.Content.(type) {
-			case float64:
-				seconds = int(v)
-			case int:
-				seconds = v
-			case string:
-				parsed, err := strconv.Atoi(v)
-				if err != nil {
-					utils.Logger.Errorf("failed to parse seconds from string: %s", err)
-					continue
-				}
-				seconds = parsed
-			default:
-				utils.Logger.Errorf("msg.Content is not a valid number type")
+			answerObj, err := services.SubmitAnswer(db, gameID, c.UserID, answer)
+			if err != nil {
+				utils.Logger.Errorf("failed to add answer: %s", err)
+				c.sendError(gameID, msg.RequestID, err)
 				continue
 			}
+			SendAckMessage(gameID, c, msg.RequestID, msg.Type, map[string]interface{}{
+				"answer_id": answerObj.ID.String(),
+				"answer":    answerObj.View(),
+			})
 
-			impostors, err := game.SelectImpostors(db, 1)
+		case MessageTypeVote:
+			utils.Logger.Debugf("Received vote: %s", msg.Content)
+
+			vote, ok := c.voteTargetFromContent(msg.Content)
+			if !ok {
+				utils.Logger.Errorf("msg.Content is not a valid vote target")
+				c.sendError(gameID, msg.RequestID, newClientError(ErrorCodeInvalidPayload, "vote must be a user ID"))
+				continue
+			}
+
+			voteObj, err := services.CastVote(db, gameID, c.UserID, vote)
 			if err != nil {
-				utils.Logger.Errorf("failed to get impostors: %s", err)
+				utils.Logger.Errorf("failed to vote: %s", err)
+				c.sendError(gameID, msg.RequestID, err)
 				continue
 			}
+			SendAckMessage(gameID, c, msg.RequestID, msg.Type, map[string]interface{}{
+				"vote": voteObj,
+			})
 
-			impostorUUIDs := make([]datatypes.UUID, 0, len(impostors))
-			for _, imp := range impostors {
-				impostorUUIDs = append(impostorUUIDs, imp.UserID)
+		case MessageTypeUpdateSettings:
+			var update services.SettingsUpdate
+			if err := decodeContent(msg.Content, &update); err != nil {
+				utils.Logger.Errorf("msg.Content is not a valid settings update: %s", err)
+				c.sendError(gameID, msg.RequestID, newClientError(ErrorCodeInvalidPayload, "settings update is malformed"))
+				continue
 			}
 
-			regularQuestion, sneakyQuestion, err := services.SelectQuestionFromCategory(game.Category)
+			err := UpdateSettings(db, gameID, c.UserID, update)
 			if err != nil {
-				utils.Logger.Errorf("failed to select question: %s", err)
+				utils.Logger.Errorf("failed to update settings of game %s: %s", gameID, err)
+				c.sendError(gameID, msg.RequestID, err)
 				continue
 			}
-			game.RegularQuestion = regularQuestion
-			game.SneakyQuestion = sneakyQuestion
-			if err := db.Save(&game).Error; err != nil {
-				utils.Logger.Errorf("failed to save game: %s", err)
+
+		case MessageTypeRematch:
+			err := Rematch(db, gameID, c.UserID)
+			if err != nil {
+				utils.Logger.Errorf("failed to reset game %s for a rematch: %s", gameID, err)
+				c.sendError(gameID, msg.RequestID, err)
 				continue
 			}
 
-			gameEnd := time.Now().Add(time.Duration(seconds) * time.Second)
-			game.SetAnswersEndTimeAndGameState(db, gameEnd)
-			SendQuestionMessage(gameID, impostorUUIDs, game.RegularQuestion, game.SneakyQuestion, gameEnd)
+		case MessageTypeKick, MessageTypeBan:
+			targetID, ok := c.userIDFromContent(msg.Content)
+			if !ok {
+				utils.Logger.Errorf("msg.Content is not a valid user ID")
+				c.sendError(gameID, msg.RequestID, newClientError(ErrorCodeInvalidPayload, "target must be a user ID"))
+				continue
+			}
 
-		case MessageTypeAnswer:
-			utils.Logger.Debugf("Received answer: %s", msg.Content)
+			err := RemoveMember(db, gameID, c.UserID, targetID, msg.Type == MessageTypeBan)
+			if err != nil {
+				utils.Logger.Errorf("failed to remove user %s from game %s: %s", targetID, gameID, err)
+				c.sendError(gameID, msg.RequestID, err)
+				continue
+			}
 
-			answer, ok := msg.Content.(string)
+		case MessageTypeLock:
+			locked, ok := msg.Content.(bool)
 			if !ok {
-				utils.Logger.Errorf("msg.Content is not a string")
+				utils.Logger.Errorf("msg.Content is not a bool")
+				c.sendError(gameID, msg.RequestID, newClientError(ErrorCodeInvalidPayload, "lock must be true or false"))
 				continue
 			}
 
-			game, err := services.GetGameByID(db, gameID)
+			err := SetLocked(db, gameID, c.UserID, locked)
 			if err != nil {
-				utils.Logger.Errorf("failed to get game: %s", err)
+				utils.Logger.Errorf("failed to lock game %s: %s", gameID, err)
+				c.sendError(gameID, msg.RequestID, err)
 				continue
 			}
 
-			game.AddAnswer(db, c.UserID, answer)
+		case MessageTypeChat:
+			text, ok := msg.Content.(string)
+			if !ok {
+				c.sendError(gameID, msg.RequestID, newClientError(ErrorCodeInvalidPayload, "chat message must be a string"))
+				continue
+			}
 
-		case MessageTypeVote:
-			utils.Logger.Debugf("Received vote: %s", msg.Content)
+			chatMessage, err := SendChat(db, gameID, c.UserID, text)
+			if err != nil {
+				utils.Logger.Debugf("failed to send chat message in game %s: %s", gameID, err)
+				c.sendError(gameID, msg.RequestID, err)
+				continue
+			}
+			SendAckMessage(gameID, c, msg.RequestID, msg.Type, map[string]interface{}{
+				"chat_message": chatMessage,
+			})
 
-			// Expecting msg.Content to be a []interface{} representing the UUID bytes
-			contentSlice, ok := msg.Content.([]interface{})
-			if !ok || len(contentSlice) != 16 {
-				utils.Logger.Errorf("msg.Content is not a valid uuid slice")
+		case MessageTypeGuess:
+			guess, ok := msg.Content.(string)
+			if !ok {
+				c.sendError(gameID, msg.RequestID, newClientError(ErrorCodeInvalidPayload, "guess must be a string"))
 				continue
 			}
-			var uuidBytes [16]byte
-			for i, v := range contentSlice {
-				f, ok := v.(float64)
-				if !ok {
-					utils.Logger.Errorf("msg.Content element is not a float64")
-					continue
-				}
-				uuidBytes[i] = byte(f)
+
+			_, err := SubmitGuess(db, gameID, c.UserID, guess)
+			if err != nil {
+				utils.Logger.Debugf("failed to submit guess in game %s: %s", gameID, err)
+				c.sendError(gameID, msg.RequestID, err)
+				continue
 			}
-			vote := datatypes.UUID(uuidBytes)
-			game, err := services.GetGameByID(db, gameID)
+
+		case MessageTypeJudgeGuess:
+			correct, ok := msg.Content.(bool)
+			if !ok {
+				c.sendError(gameID, msg.RequestID, newClientError(ErrorCodeInvalidPayload, "judgement must be true or false"))
+				continue
+			}
+
+			_, err := JudgeGuess(db, gameID, c.UserID, correct)
 			if err != nil {
-				utils.Logger.Errorf("failed to get game: %s", err)
+				utils.Logger.Debugf("failed to judge guess in game %s: %s", gameID, err)
+				c.sendError(gameID, msg.RequestID, err)
 				continue
 			}
-			game.Vote(db, c.UserID, vote)
 
 		default:
 			utils.Logger.Errorf("unknown message type: %s", msg.Type)
+			c.sendError(gameID, msg.RequestID, newClientError(ErrorCodeUnknownType, "unknown message type"))
 		}
 
 	}
 }
 
 func (c *Connection) WritePump() {
-	defer c.Conn.Close()
+	ticker := time.NewTicker(connectionLimits.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
 
-	for message := range c.Send {
-		err := c.Conn.WriteMessage(websocket.TextMessage, message)
-		if err != nil {
-			utils.Logger.Errorf("write error: %s", err)
-			break
+	for {
+		select {
+		case message := <-c.Send:
+			c.Conn.SetWriteDeadline(time.Now().Add(connectionLimits.WriteWait))
+			err := c.Conn.WriteMessage(websocket.TextMessage, message)
+			if err != nil {
+				utils.Logger.Errorf("write error: %s", err)
+				return
+			}
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(connectionLimits.WriteWait))
+			err := c.Conn.WriteMessage(websocket.PingMessage, nil)
+			if err != nil {
+				utils.Logger.Debugf("ping error: %s", err)
+				return
+			}
+		case <-c.done:
+			return
 		}
 	}
 }
 
+func (c *Connection) attach(gameID string, userID datatypes.UUID) {
+	c.GameID = gameID
+	c.UserID = userID
+}
+
+// Close closes the connection with a close frame carrying the given reason.
+// The read pump then runs the usual disconnect bookkeeping.
+func (c *Connection) Close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		err := c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(connectionLimits.WriteWait))
+		if err != nil {
+			utils.Logger.Debugf("failed to send close frame: %s", err)
+		}
+		c.Conn.Close()
+	})
+}
+
+// SendMessage queues a message for the client. A client whose queue is full
+// missed a message it cannot recover from, so it is disconnected instead of
+// carrying on with a stale view of the game.
 func (c *Connection) SendMessage(message []byte) {
 	select {
 	case c.Send <- message:
+		MetricsInstance.messageSent(c.GameID)
 	default:
-		utils.Logger.Errorf("send buffer full, dropping message")
+		MetricsInstance.messageDropped(c.GameID)
+		c.slow.Do(func() {
+			utils.Logger.Warnf("send buffer of user %s in game %s full, disconnecting", c.UserID, c.GameID)
+			MetricsInstance.slowConsumerDisconnected(c.GameID)
+			// Closing writes a close frame, which must not block the broadcast
+			go c.Close(CloseCodeSlowConsumer, "slow consumer")
+		})
+	}
+}
+
+// sendDirect sends a message to this connection only, outside of the game's
+// message stream.
+func (c *Connection) sendDirect(message Message) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		utils.Logger.Errorf("Failed to marshal message: %v", err)
+		return
+	}
+	c.SendMessage(data)
+}
+
+// messageActions maps the client message types to the game actions they
+// perform, so the state machine can decide whether they are allowed.
+var messageActions = map[MessageType]services.Action{
+	MessageTypeStart:          services.ActionStart,
+	MessageTypeAnswer:         services.ActionAnswer,
+	MessageTypeVote:           services.ActionVote,
+	MessageTypeUpdateSettings: services.ActionUpdateSettings,
+	MessageTypeRematch:        services.ActionRematch,
+	MessageTypeChat:           services.ActionChat,
+	MessageTypeGuess:          services.ActionGuess,
+	MessageTypeJudgeGuess:     services.ActionJudgeGuess,
+}
+
+// sendError reports a failed client message back to its sender.
+func (c *Connection) sendError(gameID string, requestID string, err error) {
+	c.sendDirect(errorMessage(gameID, c.UserID, requestID, toClientError(err)))
+}
+
+// uuidFromBytes reads a user ID sent as a JSON array of 16 bytes.
+func uuidFromBytes(content interface{}) (datatypes.UUID, bool) {
+	contentSlice, ok := content.([]interface{})
+	if !ok || len(contentSlice) != 16 {
+		return datatypes.UUID{}, false
+	}
+	var uuidBytes [16]byte
+	for i, v := range contentSlice {
+		f, ok := v.(float64)
+		if !ok {
+			return datatypes.UUID{}, false
+		}
+		uuidBytes[i] = byte(f)
+	}
+	return datatypes.UUID(uuidBytes), true
+}
+
+// userIDFromContent reads a user ID sent as a UUID string. Legacy clients
+// may also send a JSON array of 16 bytes.
+func (c *Connection) userIDFromContent(content interface{}) (datatypes.UUID, bool) {
+	if str, ok := content.(string); ok {
+		parsed, err := uuid.Parse(str)
+		if err != nil {
+			return datatypes.UUID{}, false
+		}
+		return datatypes.UUID(parsed), true
+	}
+
+	if c.Protocol == ProtocolLegacy {
+		return uuidFromBytes(content)
+	}
+	return datatypes.UUID{}, false
+}
+
+// voteTargetFromContent reads the user voted for, sent either as a UUID
+// string or as an object with a target_user_id. Legacy clients may also send
+// a JSON array of 16 bytes.
+func (c *Connection) voteTargetFromContent(content interface{}) (datatypes.UUID, bool) {
+	switch value := content.(type) {
+	case string:
+		parsed, err := uuid.Parse(value)
+		if err != nil {
+			return datatypes.UUID{}, false
+		}
+		return datatypes.UUID(parsed), true
+	case map[string]interface{}:
+		target, ok := value["target_user_id"].(string)
+		if !ok {
+			return datatypes.UUID{}, false
+		}
+		parsed, err := uuid.Parse(target)
+		if err != nil {
+			return datatypes.UUID{}, false
+		}
+		return datatypes.UUID(parsed), true
+	}
+
+	if c.Protocol == ProtocolLegacy {
+		return uuidFromBytes(content)
+	}
+	return datatypes.UUID{}, false
+}
+
+// decodeContent converts the loosely typed content of a client message into
+// the given struct.
+func decodeContent(content interface{}, target interface{}) error {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return err
 	}
+	return json.Unmarshal(data, target)
 }